@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"github.com/rielj/go-interpreter/token"
@@ -11,6 +12,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 }
 
 // Statement is a type that implements the Node interface
@@ -56,6 +59,22 @@ func (p *Program) String() string {
 	return out
 }
 
+// Pos returns the position of the first statement
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End returns the position after the last statement
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 // ExpressionStatement is a type that implements the Statement interface
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
@@ -69,6 +88,19 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+// Pos returns the position of the expression statement
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+// End returns the position after the expression statement
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
 // String returns the string representation of the expression statement
 func (es *ExpressionStatement) String() string {
 	// Check if the expression is not nil
@@ -94,6 +126,19 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+// Pos returns the position of the return keyword
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+// End returns the position after the return value
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
 // String returns the string representation of the return statement
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -128,6 +173,19 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+// Pos returns the position of the let keyword
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+// End returns the position after the bound value
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return ls.Name.End()
+}
+
 // String returns the string representation of the let statement
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
@@ -163,6 +221,16 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+// Pos returns the position of the identifier
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+// End returns the position after the identifier
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 // String returns the string representation of the identifier
 func (i *Identifier) String() string {
 	return i.Value
@@ -172,6 +240,7 @@ func (i *Identifier) String() string {
 type IntegerLiteral struct {
 	Token token.Token // the token.INT token
 	Value int64       // the value of the integer literal
+	Big   *big.Int    // the value instead of Value if it does not fit in an int64
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -181,11 +250,49 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+// Pos returns the position of the integer literal
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+// End returns the position after the integer literal
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
 // String returns the string representation of the integer literal
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral is a type that implements the Expression interface
+type FloatLiteral struct {
+	Token token.Token // the token.FLOAT token
+	Value float64     // the value of the float literal
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+// Pos returns the position of the float literal
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+// End returns the position after the float literal
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+
+// String returns the string representation of the float literal
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
 // PrefixExpression is a type that implements the Expression interface
 type PrefixExpression struct {
 	Token    token.Token // the prefix token, e.g. !
@@ -200,6 +307,16 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+// Pos returns the position of the operator
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+// End returns the position after the operand
+func (pe *PrefixExpression) End() token.Position {
+	return pe.Right.End()
+}
+
 // String returns the string representation of the prefix expression
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
@@ -229,6 +346,16 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the left operand
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Left.Pos()
+}
+
+// End returns the position after the right operand
+func (ie *InfixExpression) End() token.Position {
+	return ie.Right.End()
+}
+
 // String returns the string representation of the infix expression
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
@@ -260,6 +387,16 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+// Pos returns the position of the boolean
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+// End returns the position after the boolean
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
 // String returns the string representation of the boolean
 func (b *Boolean) String() string {
 	return b.Token.Literal
@@ -279,6 +416,19 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the if keyword
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+// End returns the position after the last block
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+
 // String returns the string representation of the if expression
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
@@ -303,6 +453,7 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // the token.LBRACE token
 	Statements []Statement
+	RBrace     token.Token // the closing token.RBRACE token
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -312,6 +463,23 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+// Pos returns the position of the opening brace
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+// End returns the position after the closing brace
+func (bs *BlockStatement) End() token.Position {
+	// The closing brace is missing when the input ended early
+	if bs.RBrace.Type == token.RBRACE {
+		return bs.RBrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
+
 // String returns the string representation of the block statement
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -339,6 +507,16 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+// Pos returns the position of the fn keyword
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+// End returns the position after the function body
+func (fl *FunctionLiteral) End() token.Position {
+	return fl.Body.End()
+}
+
 // String returns the string representation of the function literal
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
@@ -364,6 +542,7 @@ type CallExpression struct {
 	Token     token.Token // the token.LPAREN token
 	Function  Expression  // the function to call
 	Arguments []Expression
+	RParen    token.Token // the closing token.RPAREN token
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -373,6 +552,16 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+// Pos returns the position of the called function
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Function.Pos()
+}
+
+// End returns the position after the closing parenthesis
+func (ce *CallExpression) End() token.Position {
+	return ce.RParen.End
+}
+
 // String returns the string representation of the call expression
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
@@ -406,14 +595,67 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+// Pos returns the position of the string literal
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
+// End returns the position after the string literal
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
+
 // String returns the string representation of the string literal
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
 
+// InterpolatedString is a string with embedded expressions. Its parts
+// are *StringLiteral for the text and any expression for the rest.
+type InterpolatedString struct {
+	Token token.Token // the token.STRING_HEAD token
+	Parts []Expression
+	Tail  token.Token // the closing token.STRING_TAIL token
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+// Pos returns the position of the opening quote
+func (is *InterpolatedString) Pos() token.Position {
+	return is.Token.Pos
+}
+
+// End returns the position after the closing quote
+func (is *InterpolatedString) End() token.Position {
+	return is.Tail.End
+}
+
+// String returns the string representation of the interpolated string
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	// Write the text as is and wrap the expressions
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(text.String())
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+
+	// Return the string
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token // the token.LBRACKET token
 	Elements []Expression
+	RBracket token.Token // the closing token.RBRACKET token
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -423,6 +665,16 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
+// Pos returns the position of the opening bracket
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+// End returns the position after the closing bracket
+func (al *ArrayLiteral) End() token.Position {
+	return al.RBracket.End
+}
+
 // String returns the string representation of the array literal
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
@@ -444,9 +696,10 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // the token.LBRACKET token
-	Left  Expression
-	Index Expression
+	Token    token.Token // the token.LBRACKET token
+	Left     Expression
+	Index    Expression
+	RBracket token.Token // the closing token.RBRACKET token
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -456,6 +709,16 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the indexed expression
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Left.Pos()
+}
+
+// End returns the position after the closing bracket
+func (ie *IndexExpression) End() token.Position {
+	return ie.RBracket.End
+}
+
 // String returns the string representation of the index expression
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
@@ -478,8 +741,9 @@ func (ie *IndexExpression) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token // the token.LBRACE token
-	Pairs map[Expression]Expression
+	Token  token.Token // the token.LBRACE token
+	Pairs  map[Expression]Expression
+	RBrace token.Token // the closing token.RBRACE token
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -489,6 +753,16 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
 
+// Pos returns the position of the opening brace
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+// End returns the position after the closing brace
+func (hl *HashLiteral) End() token.Position {
+	return hl.RBrace.End
+}
+
 // String returns the string representation of the hash literal
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
@@ -508,3 +782,243 @@ func (hl *HashLiteral) String() string {
 	// Return the string
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token     token.Token // the token.WHILE token
+	Condition Expression  // the loop condition
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+
+// Pos returns the position of the while keyword
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+
+// End returns the position after the loop body
+func (ws *WhileStatement) End() token.Position {
+	return ws.Body.End()
+}
+
+// String returns the string representation of the while statement
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	// Write the while token
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	// Return the string
+	return out.String()
+}
+
+type ForStatement struct {
+	Token    token.Token // the token.FOR token
+	Variable *Identifier // the name bound to each element
+	Iterable Expression  // the value iterated over
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+// Pos returns the position of the for keyword
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+
+// End returns the position after the loop body
+func (fs *ForStatement) End() token.Position {
+	return fs.Body.End()
+}
+
+// String returns the string representation of the for statement
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	// Write the for token
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	// Return the string
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the token.BREAK token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+// Pos returns the position of the break keyword
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+// End returns the position after the break keyword
+func (bs *BreakStatement) End() token.Position {
+	return bs.Token.End
+}
+
+// String returns the string representation of the break statement
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token // the token.CONTINUE token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+// Pos returns the position of the continue keyword
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+// End returns the position after the continue keyword
+func (cs *ContinueStatement) End() token.Position {
+	return cs.Token.End
+}
+
+// String returns the string representation of the continue statement
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
+type AssignExpression struct {
+	Token    token.Token // the assignment token, e.g. = or +=
+	Target   Expression  // an *Identifier or *IndexExpression
+	Operator string      // the operator, e.g. = or +=
+	Value    Expression  // the assigned value
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+// Pos returns the position of the assignment target
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Target.Pos()
+}
+
+// End returns the position after the assigned value
+func (ae *AssignExpression) End() token.Position {
+	return ae.Value.End()
+}
+
+// String returns the string representation of the assignment expression
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	// Write the target, operator and value
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+
+	// Return the string
+	return out.String()
+}
+
+type ImportStatement struct {
+	Token token.Token    // the token.IMPORT token
+	Path  *StringLiteral // the path of the imported module
+	Alias *Identifier    // the name the module is bound to, or nil
+}
+
+func (is *ImportStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+// Pos returns the position of the import keyword
+func (is *ImportStatement) Pos() token.Position {
+	return is.Token.Pos
+}
+
+// End returns the position after the path or the alias
+func (is *ImportStatement) End() token.Position {
+	if is.Alias != nil {
+		return is.Alias.End()
+	}
+	return is.Path.End()
+}
+
+// String returns the string representation of the import statement
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	// Write the import token and the quoted path
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(`"` + is.Path.String() + `"`)
+
+	// Check if the module is renamed
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+
+	// Write the semicolon
+	out.WriteString(";")
+
+	// Return the string
+	return out.String()
+}
+
+type MemberExpression struct {
+	Token  token.Token // the token.DOT token
+	Left   Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the token
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+// Pos returns the position of the accessed expression
+func (me *MemberExpression) Pos() token.Position {
+	return me.Left.Pos()
+}
+
+// End returns the position after the member name
+func (me *MemberExpression) End() token.Position {
+	return me.Member.End()
+}
+
+// String returns the string representation of the member expression
+func (me *MemberExpression) String() string {
+	return me.Left.String() + "." + me.Member.String()
+}
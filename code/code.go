@@ -0,0 +1,340 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/rielj/go-interpreter/token"
+)
+
+// Instructions is a sequence of encoded bytecode instructions
+type Instructions []byte
+
+// String returns a human readable listing of the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// fmtInstruction formats an opcode name followed by its operands
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode is the first byte of every instruction
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the operand index
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack
+	OpPop
+
+	// OpNull, OpTrue and OpFalse push the singleton values
+	OpNull
+	OpTrue
+	OpFalse
+
+	// Arithmetic and comparison operators on the two topmost values
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+
+	// Bitwise operators on the two topmost values
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+
+	// Prefix operators on the topmost value
+	OpMinus
+	OpBang
+	OpBitNot
+
+	// OpJump jumps to the operand offset, OpJumpNotTruthy does so if the
+	// popped value is not truthy
+	OpJump
+	OpJumpNotTruthy
+
+	// OpJumpNotTruthyOrPop and OpJumpTruthyOrPop jump to the operand offset,
+	// keeping the topmost value, if it is not truthy or truthy respectively.
+	// Otherwise they pop it. They short-circuit && and ||.
+	OpJumpNotTruthyOrPop
+	OpJumpTruthyOrPop
+
+	// Global bindings. OpSetGlobal defines a binding, OpAssignGlobal
+	// updates an existing one and leaves the value on the stack.
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+
+	// Local bindings, stored in the stack slots of the current frame
+	OpGetLocal
+	OpSetLocal
+	OpAssignLocal
+
+	// Locals captured by closures live in cells. OpNewCell puts an empty
+	// cell into a local slot and OpBoxLocal moves the slot's value into one.
+	OpNewCell
+	OpBoxLocal
+	OpGetCell
+	OpSetCell
+	OpAssignCell
+
+	// Free variables of the current closure. OpLoadFree pushes the cell
+	// itself so that a nested closure can capture it.
+	OpGetFree
+	OpAssignFree
+	OpLoadFree
+
+	// OpGetBuiltin pushes the builtin function at the operand index
+	OpGetBuiltin
+
+	// Composite values
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	// OpDup2 duplicates the two topmost values
+	OpDup2
+	// OpInterpolate joins the operand count of topmost values into a string
+	OpInterpolate
+
+	// Functions
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	// OpIter replaces an iterable with an iterator, OpIterNext pushes the
+	// next element or jumps to the operand offset once it is exhausted
+	OpIter
+	OpIterNext
+
+	// OpLoopEnter records the stack depth at the start of a loop and
+	// OpLoopExit forgets it. OpUnwind drops the values pushed since the start
+	// of the loop at the operand nesting level, so that a break or continue
+	// can jump out of the middle of an expression.
+	OpLoopEnter
+	OpLoopExit
+	OpUnwind
+)
+
+// Definition describes an opcode for debugging and encoding
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpNull:  {"OpNull", []int{}},
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+
+	OpMinus:  {"OpMinus", []int{}},
+	OpBang:   {"OpBang", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+	OpAssignLocal: {"OpAssignLocal", []int{1}},
+
+	OpNewCell:    {"OpNewCell", []int{1}},
+	OpBoxLocal:   {"OpBoxLocal", []int{1}},
+	OpGetCell:    {"OpGetCell", []int{1}},
+	OpSetCell:    {"OpSetCell", []int{1}},
+	OpAssignCell: {"OpAssignCell", []int{1}},
+
+	OpGetFree:    {"OpGetFree", []int{1}},
+	OpAssignFree: {"OpAssignFree", []int{1}},
+	OpLoadFree:   {"OpLoadFree", []int{1}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpDup2:     {"OpDup2", []int{}},
+
+	OpInterpolate: {"OpInterpolate", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpLoopEnter: {"OpLoopEnter", []int{}},
+	OpLoopExit:  {"OpLoopExit", []int{}},
+	OpUnwind:    {"OpUnwind", []int{1}},
+}
+
+// Lookup returns the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction from an opcode and its operands
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction and returns them
+// together with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two byte operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one byte operand
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// PositionEntry records the source position of the instructions starting
+// at Offset
+type PositionEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PositionTable maps instruction offsets to source positions. Entries are
+// sorted by offset and each one applies until the next.
+type PositionTable []PositionEntry
+
+// Lookup returns the source position of the instruction at the offset
+func (t PositionTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return t[i-1].Pos
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// build compiles a script and writes the bytecode to a file. It returns the
+// process exit status.
+func build(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "write the compiled program to `file`")
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(stderr, "usage: monkey build FILE [-o OUT]")
+		return 2
+	}
+
+	filename := files[0]
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, ok := compile(filename, string(src), stderr)
+	if !ok {
+		return 1
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mkc"
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	if _, err := bytecode.WriteTo(f); err != nil {
+		f.Close()
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// disasm prints the bytecode of a script or compiled program. It returns
+// the process exit status.
+func disasm(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: monkey disasm FILE")
+		return 2
+	}
+
+	src, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, ok := compile(args[0], string(src), stderr)
+	if !ok {
+		return 1
+	}
+
+	if err := bytecode.Disassemble(stdout); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// parseArgs parses flags that may come before or after the file arguments,
+// as in "monkey build FILE -o OUT"
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return files, nil
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
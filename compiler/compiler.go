@@ -0,0 +1,861 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/token"
+)
+
+// Opcodes of the infix operators
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+}
+
+// Opcodes of the prefix operators
+var prefixOperators = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+// Compiler lowers an AST to bytecode for the virtual machine
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// Position of the node being compiled, recorded for every instruction
+	pos token.Position
+
+	// First operand that did not fit its instruction, reported once the
+	// program is compiled
+	err error
+}
+
+// EmittedInstruction is an instruction that was added to a scope
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           code.PositionTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	// Enclosing loops, innermost last
+	loops []*loop
+}
+
+// loop is a loop being compiled
+type loop struct {
+	start  int   // where continue jumps to
+	breaks []int // jumps to patch with the end of the loop
+	level  int   // number of enclosing loops in the same function
+}
+
+// Bytecode is the result of a compilation
+type Bytecode struct {
+	Main        *object.CompiledFunction
+	Constants   []object.Object
+	GlobalNames []string
+}
+
+// New returns a compiler with a fresh global scope
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range evaluator.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+// NewWithState returns a compiler that continues with the globals and
+// constants of an earlier compilation, as the REPL does
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// Compile compiles a node into the current scope
+func (c *Compiler) Compile(node ast.Node) error {
+	// Instructions point at the innermost node they were compiled from
+	prevPos := c.pos
+	if pos := node.Pos(); pos.IsValid() {
+		c.pos = pos
+	}
+	defer func() { c.pos = prevPos }()
+
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		c.declare(node, nil)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		if c.err != nil {
+			return c.err
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	// Let statements store into the symbol declared for the scope. The value
+	// still sees what the name shadows.
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value, false)
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			// Name functions after their binding
+			if err := c.compileFunctionLiteral(fn, node.Name.Value); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		c.symbolTable.Bind(node.Name.Value)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// Loops
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		current := c.currentLoop()
+		if current == nil {
+			return fmt.Errorf("break outside of a loop")
+		}
+		c.emit(code.OpUnwind, current.level)
+		current.breaks = append(current.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		current := c.currentLoop()
+		if current == nil {
+			return fmt.Errorf("continue outside of a loop")
+		}
+		c.emit(code.OpUnwind, current.level)
+		c.emit(code.OpJump, current.start)
+
+	// Literals
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(&object.BigInt{Value: node.Big}))
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+		}
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// Sort the keys so that the output does not depend on map order
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+
+	// Expressions
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		return c.emitInfix(node.Operator)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ImportStatement, *ast.MemberExpression:
+		return fmt.Errorf("modules are not supported by the compiler")
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// Bytecode returns the compiled program
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			Positions:    scope.positions,
+			NumLocals:    c.symbolTable.NumLocals(),
+			LocalNames:   c.symbolTable.LocalNames(),
+		},
+		Constants:   c.constants,
+		GlobalNames: c.symbolTable.GlobalNames(),
+	}
+}
+
+// Helper function to compile if expressions. Both branches leave a value
+// on the stack.
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Jump over the consequence if the condition is not truthy
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	// Jump over the alternative after the consequence
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// Helper function to compile && and ||, which skip their right side when
+// the left side decides the result and leave the deciding value on the stack
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	op := code.OpJumpNotTruthyOrPop
+	if node.Operator == "||" {
+		op = code.OpJumpTruthyOrPop
+	}
+	jumpPos := c.emit(op, 9999)
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// Helper function to compile a block that evaluates to the value of its
+// last expression statement, or to NULL
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if endsWithExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// Helper function to compile function literals into closures
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prevPos }()
+
+	c.enterScope()
+
+	params := []string{}
+	for _, p := range node.Parameters {
+		params = append(params, p.Value)
+	}
+	c.declare(node.Body, params)
+
+	// Give every captured variable its cell. Parameters already hold the
+	// argument, which is moved into the cell.
+	for i, local := range c.symbolTable.LocalNames() {
+		if !c.symbolTable.store[local].Boxed {
+			continue
+		}
+		if i < len(params) {
+			c.emit(code.OpBoxLocal, i)
+		} else {
+			c.emit(code.OpNewCell, i)
+		}
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// Return the value of a trailing expression, or NULL
+	if endsWithExpression(node.Body) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	localNames := c.symbolTable.LocalNames()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	// Push the cells of the captured variables for OpClosure
+	freeNames := []string{}
+	for _, s := range freeSymbols {
+		if err := c.loadCell(s); err != nil {
+			return err
+		}
+		freeNames = append(freeNames, s.Name)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     max(numLocals, len(params)),
+		NumParameters: len(params),
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// Helper function to compile while loops
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	c.emit(code.OpLoopEnter)
+	start := len(c.currentInstructions())
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.enterLoop(start)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(exitPos, end)
+	c.leaveLoop(end)
+	c.emit(code.OpLoopExit)
+
+	return nil
+}
+
+// Helper function to compile for loops. The iterator stays on the stack
+// while the body runs, and the body has a scope of its own whose cells are
+// created afresh for every iteration.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	c.emit(code.OpLoopEnter)
+
+	outer := c.symbolTable
+	c.symbolTable = NewBlockSymbolTable(outer)
+	defer func() { c.symbolTable = outer }()
+
+	c.declare(node.Body, []string{node.Variable.Value})
+
+	start := len(c.currentInstructions())
+	nextPos := c.emit(code.OpIterNext, 9999)
+
+	// Fresh cells for the captured variables of this iteration
+	boxed := []int{}
+	for _, symbol := range c.symbolTable.store {
+		if symbol.Scope == LocalScope && symbol.Boxed {
+			boxed = append(boxed, symbol.Index)
+		}
+	}
+	sort.Ints(boxed)
+	for _, index := range boxed {
+		c.emit(code.OpNewCell, index)
+	}
+	c.storeSymbol(c.symbolTable.store[node.Variable.Value])
+
+	c.enterLoop(start)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	// Breaks and the exhausted iterator both end up here
+	end := len(c.currentInstructions())
+	c.changeOperand(nextPos, end)
+	c.leaveLoop(end)
+	c.emit(code.OpLoopExit)
+	c.emit(code.OpPop)
+
+	return nil
+}
+
+// Helper function to compile assignments. The assigned value is left on the
+// stack as the value of the expression.
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	compound := node.Operator != "="
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolve(target.Value)
+		if symbol.Scope == BuiltinScope {
+			return fmt.Errorf("assignment to undeclared identifier: %s", target.Value)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			if err := c.emitInfix(operator); err != nil {
+				return err
+			}
+		}
+		c.assignSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		// Read the current element, keeping the operands for the store
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			if err := c.emitInfix(operator); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// Helper function to emit the opcode of an infix operator
+func (c *Compiler) emitInfix(operator string) error {
+	op, ok := infixOperators[operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+// Helper function to define the names a scope declares before compiling
+// it, so that functions can refer to bindings that follow them. Locals used
+// by nested functions are boxed into cells shared with the closures.
+func (c *Compiler) declare(body ast.Node, params []string) {
+	captured := capturedNames(body)
+
+	global := c.symbolTable.Outer == nil
+	for _, name := range params {
+		c.symbolTable.Define(name, captured[name] && !global)
+	}
+	for _, name := range declaredNames(body) {
+		c.symbolTable.Declare(name, captured[name] && !global)
+	}
+}
+
+// Helper function to resolve a name. Unknown names are globals that have
+// not been defined yet, so that using them fails at run time like it does
+// in the evaluator.
+func (c *Compiler) resolve(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		symbol = c.symbolTable.Global().Define(name, false)
+	}
+	return symbol
+}
+
+// Helper function to push the value of a symbol
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Boxed {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+// Helper function to pop a value into the binding of a let statement
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Boxed:
+		c.emit(code.OpSetCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// Helper function to update an existing binding, keeping the value on the
+// stack
+func (c *Compiler) assignSymbol(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpAssignGlobal, s.Index)
+	case s.Scope == FreeScope:
+		c.emit(code.OpAssignFree, s.Index)
+	case s.Boxed:
+		c.emit(code.OpAssignCell, s.Index)
+	default:
+		c.emit(code.OpAssignLocal, s.Index)
+	}
+}
+
+// Helper function to push the cell of a variable captured by a closure
+func (c *Compiler) loadCell(s Symbol) error {
+	switch {
+	case s.Scope == FreeScope:
+		c.emit(code.OpLoadFree, s.Index)
+	case s.Scope == LocalScope && s.Boxed:
+		// The slot of a boxed local holds the cell itself
+		c.emit(code.OpGetLocal, s.Index)
+	default:
+		return fmt.Errorf("cannot capture %s variable %s", s.Scope, s.Name)
+	}
+	return nil
+}
+
+// Helper function to add a value to the constant pool
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// Helper function to encode and add an instruction, returning its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// Helper function to record an error for operands too large for their
+// width, such as the index of the 257th local of a function, which Make
+// would silently truncate
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for i, o := range operands {
+		if max := 1<<(8*def.OperandWidths[i]) - 1; o > max {
+			c.err = fmt.Errorf("%s: program too large for the compiler, operand %d of %s exceeds %d",
+				c.pos, o, def.Name, max)
+			return
+		}
+	}
+}
+
+// Helper function to append an instruction and record its source position
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions,
+			code.PositionEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+	scope.instructions = append(scope.instructions, ins...)
+
+	return posNewInstruction
+}
+
+// Helper function to remember the last two instructions
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+// Helper function to check the last instruction of the current scope
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// Helper function to drop the trailing OpPop, leaving its value on the stack
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction
+
+	scope.instructions = scope.instructions[:last.Position]
+	scope.lastInstruction = scope.previousInstruction
+
+	// Forget positions that only applied to the removed instruction
+	for n := len(scope.positions); n > 0 && scope.positions[n-1].Offset >= last.Position; n-- {
+		scope.positions = scope.positions[:n-1]
+	}
+}
+
+// Helper function to return the value of a trailing expression statement
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// Helper function to overwrite an instruction in place
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// Helper function to patch the operand of a jump
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// Helper function to get the instructions of the current scope
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// Helper function to start compiling a function
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// Helper function to finish compiling a function
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// Helper function to start compiling a loop body
+func (c *Compiler) enterLoop(start int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{start: start, level: len(scope.loops)})
+}
+
+// Helper function to finish a loop, pointing its breaks at end
+func (c *Compiler) leaveLoop(end int) {
+	scope := &c.scopes[c.scopeIndex]
+	current := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range current.breaks {
+		c.changeOperand(pos, end)
+	}
+}
+
+// Helper function to get the innermost loop of the current function
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// Helper function to check if a block ends with an expression statement,
+// whose value is the value of the block
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
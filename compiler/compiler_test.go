@@ -0,0 +1,676 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Operands are evaluated left to right, also for <
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "5 % 2 >= 1",
+			expectedConstants: []interface{}{5, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGreaterEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1 << 2 | 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Blocks without a trailing expression evaluate to NULL
+			input:             "if (true) { let x = 1; } else { 2 }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthyOrPop, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "false || 1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpTruthyOrPop, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpLessThan),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Functions may refer to globals that are defined after them
+			input: "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The captured local lives in a cell shared with the closure
+			input: "fn(a) { fn() { a += 1 } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpAssignFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpBoxLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Locals that are not captured stay on the stack
+			input: "fn() { let b = 2; b }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { break }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpLoopEnter),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0005
+				code.Make(code.OpUnwind, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpJump, 1),
+				// 0013
+				code.Make(code.OpLoopExit),
+			},
+		},
+		{
+			// The loop variable is a local of the main program
+			input:             "for (x in [1]) { continue }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpLoopEnter),
+				// 0008
+				code.Make(code.OpIterNext, 21),
+				// 0011
+				code.Make(code.OpSetLocal, 0),
+				// 0013
+				code.Make(code.OpUnwind, 0),
+				// 0015
+				code.Make(code.OpJump, 8),
+				// 0018
+				code.Make(code.OpJump, 8),
+				// 0021
+				code.Make(code.OpLoopExit),
+				// 0022
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Loop control targets the innermost loop by its nesting level
+			input:             "while (true) { while (false) { continue } break }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpLoopEnter),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 27),
+				// 0005
+				code.Make(code.OpLoopEnter),
+				// 0006
+				code.Make(code.OpFalse),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 18),
+				// 0010
+				code.Make(code.OpUnwind, 1),
+				// 0012
+				code.Make(code.OpJump, 6),
+				// 0015
+				code.Make(code.OpJump, 6),
+				// 0018
+				code.Make(code.OpLoopExit),
+				// 0019
+				code.Make(code.OpUnwind, 0),
+				// 0021
+				code.Make(code.OpJump, 27),
+				// 0024
+				code.Make(code.OpJump, 1),
+				// 0027
+				code.Make(code.OpLoopExit),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "len([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestInstructionPositions(t *testing.T) {
+	program := parse("let x = 1;\nx + true")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	main := compiler.Bytecode().Main
+
+	// OpConstant, OpSetGlobal, OpGetGlobal, OpConstant, OpAdd
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:9"},
+		{3, "1:1"},
+		{6, "2:1"},
+		{10, "2:1"},
+	}
+
+	for _, tt := range tests {
+		if got := main.Positions.Lookup(tt.offset).String(); got != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s, got=%s",
+				tt.offset, tt.expected, got)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a", false)
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong global symbol. got=%+v", a)
+	}
+	// A second let rebinds the same variable
+	if again := global.Define("a", false); again != a {
+		t.Errorf("redefinition created a new symbol. got=%+v", again)
+	}
+
+	// Loop bodies of the main program get local slots
+	loop := NewBlockSymbolTable(global)
+	x := loop.Define("x", true)
+	if x != (Symbol{Name: "x", Scope: LocalScope, Index: 0, Boxed: true}) {
+		t.Errorf("wrong loop symbol. got=%+v", x)
+	}
+
+	fn := NewEnclosedSymbolTable(loop)
+	fn.Define("b", false)
+	inner := NewBlockSymbolTable(fn)
+	inner.Define("c", false)
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "x", Scope: FreeScope, Index: 0},
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1},
+	}
+	for _, sym := range expected {
+		result, ok := inner.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if fn.NumLocals() != 2 || inner.NumLocals() != 2 {
+		t.Errorf("loop body does not share the function's slots. got=%d, %d",
+			fn.NumLocals(), inner.NumLocals())
+	}
+	if len(fn.FreeSymbols) != 1 || fn.FreeSymbols[0] != x {
+		t.Errorf("wrong free symbols. got=%+v", fn.FreeSymbols)
+	}
+	if _, ok := global.Resolve("c"); ok {
+		t.Errorf("loop local visible outside of the loop")
+	}
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+let big = 99999999999999999999;
+let counter = fn(start) {
+	let n = start;
+	fn() { n = n + 1.5; [len("count"), "count: ${n}", big] }
+};
+let next = counter(-3);
+next()
+`
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := compiler.Bytecode()
+
+	var buf bytes.Buffer
+	if _, err := original.WriteTo(&buf); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	if !IsBytecode(buf.Bytes()) {
+		t.Fatalf("written bytecode has no header")
+	}
+	loaded, err := ReadBytecode(&buf)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+
+	// The listing covers the instructions, constants, names and positions
+	var want, got strings.Builder
+	original.Disassemble(&want)
+	loaded.Disassemble(&got)
+	if got.String() != want.String() {
+		t.Errorf("wrong bytecode after round trip.\nwant=\n%s\ngot=\n%s", want.String(), got.String())
+	}
+	for i, c := range original.Constants {
+		if _, ok := c.(*object.CompiledFunction); ok {
+			continue
+		}
+		if loaded.Constants[i].Inspect() != c.Inspect() {
+			t.Errorf("constant %d wrong. want=%s, got=%s", i, c.Inspect(), loaded.Constants[i].Inspect())
+		}
+	}
+}
+
+func TestReadBytecodeErrors(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let f = fn(x) { x * 2 }; f(21)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if _, err := compiler.Bytecode().WriteTo(&buf); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	wrongVersion := append([]byte{}, valid...)
+	wrongVersion[len(Magic)+1] = Version + 1
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled Monkey program"},
+		{[]byte("MKC"), "not a compiled Monkey program"},
+		{wrongVersion, fmt.Sprintf("unsupported bytecode version %d, want %d", Version+1, Version)},
+		{valid[:len(valid)-3], "corrupt bytecode: unexpected end of file"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadBytecode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let greet = fn(name) { \"hi \" + name };\nputs(greet(\"bob\"))")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out strings.Builder
+	if err := compiler.Bytecode().Disassemble(&out); err != nil {
+		t.Fatalf("disassemble error: %s", err)
+	}
+
+	expected := []string{
+		"== main ==",
+		"0000 1:13    OpClosure 1 0                   ; fn greet, 0 free",
+		"0004 1:1     OpSetGlobal 0                   ; greet",
+		"0007 2:1     OpGetBuiltin 5                  ; puts",
+		"== constant 1: fn greet, 1 parameters, 1 locals ==",
+		"0000 1:24    OpConstant 0                    ; \"hi \"",
+		"0003 1:32    OpGetLocal 0                    ; name",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("listing does not contain %q. got=\n%s", line, out.String())
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	// Identifiers cannot contain digits, so name the locals vaa, vab, ...
+	names := func(n int) []string {
+		out := []string{}
+		for i := 0; i < n; i++ {
+			out = append(out, "v"+string(rune('a'+i/26))+string(rune('a'+i%26)))
+		}
+		return out
+	}
+	lets := func(n int) string {
+		var out strings.Builder
+		for i, name := range names(n) {
+			fmt.Fprintf(&out, "let %s = %d; ", name, i)
+		}
+		return out.String()
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { " + lets(256) + "vja }", ""},
+		{"fn() { " + lets(257) + "vja }", "operand 256 of OpSetLocal exceeds 255"},
+		{"puts(" + strings.Join(names(255), ", ") + ")", ""},
+		{"puts(" + strings.Join(names(256), ", ") + ")", "operand 256 of OpCall exceeds 255"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error: %s", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Main.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if actual.String() != concatted.String() {
+		return fmt.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s",
+			concatted, actual)
+	}
+
+	return nil
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. want=%d, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/object"
+)
+
+// Disassemble writes a listing of the main program and every function in
+// the constant pool. Each instruction is shown with its offset, source
+// position and decoded operands, followed by what the operands refer to.
+func (b *Bytecode) Disassemble(w io.Writer) error {
+	var out strings.Builder
+
+	b.disassembleFunction(&out, "main", b.Main)
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		title := fmt.Sprintf("constant %d: %s, %d parameters, %d locals",
+			i, functionName(fn), fn.NumParameters, fn.NumLocals)
+		out.WriteString("\n")
+		b.disassembleFunction(&out, title, fn)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Helper function to list the instructions of one function
+func (b *Bytecode) disassembleFunction(out *strings.Builder, title string, fn *object.CompiledFunction) {
+	fmt.Fprintf(out, "== %s ==\n", title)
+
+	ins := fn.Instructions
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		if i+1+operandsWidth(def) > len(ins) {
+			fmt.Fprintf(out, "%04d ERROR: truncated %s\n", i, def.Name)
+			break
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		text := def.Name
+		for _, o := range operands {
+			text += " " + strconv.Itoa(o)
+		}
+		line := fmt.Sprintf("%04d %-7s %s", i, lineColumn(fn.Positions, i), text)
+		if comment := b.describe(fn, code.Opcode(ins[i]), operands); comment != "" {
+			line = fmt.Sprintf("%-44s ; %s", line, comment)
+		}
+		out.WriteString(line + "\n")
+
+		i += 1 + read
+	}
+}
+
+// Helper function to explain the operands of an instruction
+func (b *Bytecode) describe(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant:
+		return b.describeConstant(operands[0])
+	case code.OpClosure:
+		return fmt.Sprintf("%s, %d free", b.describeConstant(operands[0]), operands[1])
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+		return nameAt(b.GlobalNames, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal, code.OpNewCell,
+		code.OpBoxLocal, code.OpGetCell, code.OpSetCell, code.OpAssignCell:
+		return nameAt(fn.LocalNames, operands[0])
+	case code.OpGetFree, code.OpAssignFree, code.OpLoadFree:
+		return nameAt(fn.FreeNames, operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(evaluator.Builtins) {
+			return evaluator.Builtins[operands[0]].Name
+		}
+	}
+	return ""
+}
+
+// Helper function to show a constant in a listing
+func (b *Bytecode) describeConstant(index int) string {
+	if index >= len(b.Constants) {
+		return "?"
+	}
+	switch c := b.Constants[index].(type) {
+	case *object.String:
+		return strconv.Quote(c.Value)
+	case *object.CompiledFunction:
+		return functionName(c)
+	default:
+		return c.Inspect()
+	}
+}
+
+// Helper function to get the line and column of an instruction. The file
+// is the same for the whole listing.
+func lineColumn(positions code.PositionTable, offset int) string {
+	pos := positions.Lookup(offset)
+	if !pos.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+// Helper function to name a function in a listing
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "fn <anonymous>"
+	}
+	return "fn " + fn.Name
+}
+
+// Helper function to look up a name, tolerating bad indexes
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return "?"
+}
+
+// Helper function to get the number of operand bytes of an instruction
+func operandsWidth(def *code.Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
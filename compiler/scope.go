@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"github.com/rielj/go-interpreter/ast"
+)
+
+// declaredNames returns the names bound by let statements of a scope, in
+// order. Function literals and for loop bodies have scopes of their own and
+// are not searched.
+func declaredNames(node ast.Node) []string {
+	names := []string{}
+
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			names = append(names, n.Name.Value)
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ForStatement:
+			walk(n.Iterable, visit)
+			return false
+		}
+		return true
+	}
+	walk(node, visit)
+
+	return names
+}
+
+// capturedNames returns the names used inside the function literals nested
+// in a node. Locals with these names may be captured by a closure.
+func capturedNames(node ast.Node) map[string]bool {
+	names := map[string]bool{}
+
+	walk(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionLiteral); !ok {
+			return true
+		}
+		walk(n, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+			return true
+		})
+		return false
+	})
+
+	return names
+}
+
+// walk calls fn for a node and its descendants, depth first. The children
+// of a node are skipped if fn returns false.
+func walk(node ast.Node, fn func(ast.Node) bool) {
+	if !fn(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			walk(s, fn)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			walk(s, fn)
+		}
+	case *ast.ExpressionStatement:
+		walk(node.Expression, fn)
+	case *ast.LetStatement:
+		walk(node.Name, fn)
+		walk(node.Value, fn)
+	case *ast.ReturnStatement:
+		walk(node.ReturnValue, fn)
+	case *ast.WhileStatement:
+		walk(node.Condition, fn)
+		walk(node.Body, fn)
+	case *ast.ForStatement:
+		walk(node.Variable, fn)
+		walk(node.Iterable, fn)
+		walk(node.Body, fn)
+	case *ast.PrefixExpression:
+		walk(node.Right, fn)
+	case *ast.InfixExpression:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case *ast.AssignExpression:
+		walk(node.Target, fn)
+		walk(node.Value, fn)
+	case *ast.IfExpression:
+		walk(node.Condition, fn)
+		walk(node.Consequence, fn)
+		if node.Alternative != nil {
+			walk(node.Alternative, fn)
+		}
+	case *ast.FunctionLiteral:
+		for _, p := range node.Parameters {
+			walk(p, fn)
+		}
+		walk(node.Body, fn)
+	case *ast.CallExpression:
+		walk(node.Function, fn)
+		for _, a := range node.Arguments {
+			walk(a, fn)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			walk(el, fn)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			walk(part, fn)
+		}
+	case *ast.IndexExpression:
+		walk(node.Left, fn)
+		walk(node.Index, fn)
+	case *ast.MemberExpression:
+		walk(node.Left, fn)
+	case *ast.HashLiteral:
+		for k, v := range node.Pairs {
+			walk(k, fn)
+			walk(v, fn)
+		}
+	}
+}
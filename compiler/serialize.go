@@ -0,0 +1,342 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/token"
+)
+
+// A compiled program is stored as
+//
+//	magic     "MKC\x00"
+//	version   uint16, big endian
+//	files     the file names used by the debug line tables
+//	globals   the names of the globals
+//	constants the constant pool, each entry tagged with its type
+//	main      the main program, encoded like a function constant
+//
+// Counts, lengths and integers are varints. A function is its name,
+// parameter and local counts, local and free variable names, instructions
+// and debug line table.
+
+// Magic is the header of compiled Monkey programs
+const Magic = "MKC\x00"
+
+// Version is the version of the bytecode format. Files of other versions
+// cannot be loaded.
+const Version = 5
+
+// Tags of the constant pool entries
+const (
+	tagInteger byte = iota + 1
+	tagBigInt
+	tagFloat
+	tagString
+	tagFunction
+)
+
+// IsBytecode reports whether data starts with the header of a compiled
+// program
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// WriteTo writes the bytecode in the binary format
+func (b *Bytecode) WriteTo(w io.Writer) (int64, error) {
+	e := &encoder{files: map[string]int{}}
+
+	// File names come first, so collect them before encoding the rest
+	var body bytes.Buffer
+	e.w = &body
+
+	e.strings(b.GlobalNames)
+	e.uvarint(uint64(len(b.Constants)))
+	for _, c := range b.Constants {
+		e.constant(c)
+	}
+	e.function(b.Main)
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(Magic)
+	binary.Write(&header, binary.BigEndian, uint16(Version))
+	e.w = &header
+	e.strings(e.fileNames)
+
+	n, err := header.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	m, err := body.WriteTo(w)
+	return n + m, err
+}
+
+// ReadBytecode reads a program written by WriteTo
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != Magic {
+		return nil, errors.New("not a compiled Monkey program")
+	}
+	var version uint16
+	if err := binary.Read(d.r, binary.BigEndian, &version); err != nil {
+		return nil, errors.New("not a compiled Monkey program")
+	}
+	if version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, Version)
+	}
+
+	d.fileNames = d.strings()
+	b := &Bytecode{GlobalNames: d.strings()}
+
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		b.Constants = append(b.Constants, d.constant())
+	}
+	b.Main = d.function()
+
+	if d.err != nil {
+		if d.err == io.EOF || d.err == io.ErrUnexpectedEOF {
+			return nil, errors.New("corrupt bytecode: unexpected end of file")
+		}
+		return nil, fmt.Errorf("corrupt bytecode: %s", d.err)
+	}
+
+	return b, nil
+}
+
+// encoder writes the parts of the format, remembering the first error
+type encoder struct {
+	w   io.Writer
+	err error
+
+	// Table of the file names of all positions
+	files     map[string]int
+	fileNames []string
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) uvarint(x uint64) {
+	e.write(binary.AppendUvarint(nil, x))
+}
+
+func (e *encoder) varint(x int64) {
+	e.write(binary.AppendVarint(nil, x))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *encoder) strings(s []string) {
+	e.uvarint(uint64(len(s)))
+	for _, str := range s {
+		e.string(str)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.write([]byte{tagInteger})
+		e.varint(obj.Value)
+	case *object.BigInt:
+		e.write([]byte{tagBigInt})
+		e.string(obj.Value.Text(16))
+	case *object.Float:
+		e.write([]byte{tagFloat})
+		e.uvarint(math.Float64bits(obj.Value))
+	case *object.String:
+		e.write([]byte{tagString})
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.write([]byte{tagFunction})
+		e.function(obj)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot serialize constant of type %s", obj.Type())
+		}
+	}
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.string(fn.Name)
+	e.uvarint(uint64(fn.NumParameters))
+	e.uvarint(uint64(fn.NumLocals))
+	e.strings(fn.LocalNames)
+	e.strings(fn.FreeNames)
+
+	e.uvarint(uint64(len(fn.Instructions)))
+	e.write(fn.Instructions)
+
+	// The debug line table
+	e.uvarint(uint64(len(fn.Positions)))
+	for _, entry := range fn.Positions {
+		e.uvarint(uint64(entry.Offset))
+		e.uvarint(uint64(e.file(entry.Pos.Filename)))
+		e.uvarint(uint64(entry.Pos.Offset))
+		e.uvarint(uint64(entry.Pos.Line))
+		e.uvarint(uint64(entry.Pos.Column))
+	}
+}
+
+// file returns the index of a file name in the table
+func (e *encoder) file(name string) int {
+	index, ok := e.files[name]
+	if !ok {
+		index = len(e.fileNames)
+		e.files[name] = index
+		e.fileNames = append(e.fileNames, name)
+	}
+	return index
+}
+
+// decoder reads the parts of the format, remembering the first error
+type decoder struct {
+	r   *bufio.Reader
+	err error
+
+	fileNames []string
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = err
+	}
+	return x
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	x, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = err
+	}
+	return x
+}
+
+// length reads a count or length, rejecting sizes no valid file can have
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > math.MaxInt32 {
+		d.fail("length %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+	// Read in chunks so that a corrupt length cannot allocate huge buffers
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	s := []string{}
+	for i := 0; i < n && d.err == nil; i++ {
+		s = append(s, d.string())
+	}
+	return s
+}
+
+func (d *decoder) constant() object.Object {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		d.err = err
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagBigInt:
+		text := d.string()
+		value, ok := new(big.Int).SetString(text, 16)
+		if !ok && d.err == nil {
+			d.fail("invalid big integer %q", text)
+		}
+		return &object.BigInt{Value: value}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uvarint())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		return d.function()
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Name:          d.string(),
+		NumParameters: d.length(),
+		NumLocals:     d.length(),
+		LocalNames:    d.strings(),
+		FreeNames:     d.strings(),
+		Instructions:  code.Instructions(d.bytes()),
+	}
+
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		entry := code.PositionEntry{Offset: d.length()}
+		file := d.length()
+		entry.Pos = token.Position{
+			Offset: d.length(),
+			Line:   d.length(),
+			Column: d.length(),
+		}
+		if file >= len(d.fileNames) {
+			d.fail("file index %d out of range", file)
+			break
+		}
+		entry.Pos.Filename = d.fileNames[file]
+		fn.Positions = append(fn.Positions, entry)
+	}
+
+	return fn
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
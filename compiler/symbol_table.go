@@ -0,0 +1,198 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+// Symbol is a name resolved at compile time
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// Boxed locals are captured by a closure and live in a cell
+	Boxed bool
+}
+
+// SymbolTable maps the names of a scope to symbols. There is one table for
+// the globals, one for each function and one for each for loop body. Loop
+// bodies share the local slots of the function they appear in.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	block bool
+
+	// Names declared in the scope whose let statement has not been compiled
+	// yet, mapped to the builtin they shadow, if any
+	pending map[string]Symbol
+
+	// Globals of the outermost table
+	globalNames []string
+	// Local slots of a function, or of the main program for the global table
+	localNames []string
+
+	FreeSymbols []Symbol
+}
+
+// NewSymbolTable returns the table of the global scope
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), pending: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable returns the table of a function
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable returns the table of a loop body, whose names are
+// only visible inside the body
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// Define binds a name in the scope. Defining a name twice in the same scope
+// returns the existing symbol, because a second let rebinds the variable.
+func (s *SymbolTable) Define(name string, boxed bool) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		if boxed && !symbol.Boxed {
+			symbol.Boxed = true
+			s.store[name] = symbol
+		}
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Boxed: boxed}
+	owner := s.owner()
+	if owner == s && s.Outer == nil {
+		symbol.Scope = GlobalScope
+		symbol.Index = len(owner.globalNames)
+		owner.globalNames = append(owner.globalNames, name)
+	} else {
+		symbol.Scope = LocalScope
+		symbol.Index = len(owner.localNames)
+		owner.localNames = append(owner.localNames, name)
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// Declare defines a name bound by a let statement further on in the scope.
+// Until Bind is called, the function the scope belongs to sees what the name
+// shadows instead, like the evaluator does before the let has run.
+// Functions nested in the scope see the new binding, so that they can refer
+// to bindings that follow them.
+func (s *SymbolTable) Declare(name string, boxed bool) Symbol {
+	previous, ok := s.store[name]
+	if !ok || previous.Scope == BuiltinScope {
+		s.pending[name] = previous
+	}
+	return s.Define(name, boxed)
+}
+
+// Bind makes a declared name refer to its binding from now on
+func (s *SymbolTable) Bind(name string) {
+	delete(s.pending, name)
+}
+
+// DefineBuiltin binds the name of a builtin function
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks a name up in the scope and its outer scopes. Locals of an
+// enclosing function become free variables of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// Helper function to resolve a name. Nested is set once the lookup has left
+// the function it started in, which sees names that are still pending.
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if shadowed, pending := s.pending[name]; pending && !nested {
+		if s.Outer == nil {
+			// Globals that shadow nothing fail at run time until bound
+			if shadowed.Scope == BuiltinScope {
+				return shadowed, true
+			}
+			return symbol, ok
+		}
+		ok = false
+	}
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.resolve(name, nested || !s.block)
+	if !ok {
+		return symbol, ok
+	}
+
+	// Loop bodies belong to the same function as their outer scope
+	if s.block || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Global returns the table of the global scope
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// NumLocals returns the number of local slots of the function the scope
+// belongs to
+func (s *SymbolTable) NumLocals() int {
+	return len(s.owner().localNames)
+}
+
+// LocalNames returns the names of the local slots, indexed by slot
+func (s *SymbolTable) LocalNames() []string {
+	return s.owner().localNames
+}
+
+// GlobalNames returns the names of the globals, indexed by global slot
+func (s *SymbolTable) GlobalNames() []string {
+	return s.Global().globalNames
+}
+
+// Helper function to find the table that owns the local slots of a scope
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// Helper function to capture a variable of an enclosing function. A pending
+// name keeps its own symbol, so the capture is looked up again on every use.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	for i, free := range s.FreeSymbols {
+		if free.Name == original.Name && free.Scope == original.Scope && free.Index == original.Index {
+			return Symbol{Name: original.Name, Index: i, Scope: FreeScope}
+		}
+	}
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	if _, pending := s.pending[original.Name]; !pending {
+		s.store[original.Name] = symbol
+	}
+	return symbol
+}
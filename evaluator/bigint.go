@@ -0,0 +1,161 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/rielj/go-interpreter/object"
+)
+
+// Helper function to evaluate integer infix expressions where at least one
+// side is a big integer
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	// Get the values of the left and right sides
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	// Evaluate the integer expression based on the operator
+	switch operator {
+	// Addition
+	case "+":
+		return normalizeBigInt(new(big.Int).Add(leftVal, rightVal))
+	// Subtraction
+	case "-":
+		return normalizeBigInt(new(big.Int).Sub(leftVal, rightVal))
+	// Multiplication
+	case "*":
+		return normalizeBigInt(new(big.Int).Mul(leftVal, rightVal))
+	// Division, truncated towards zero like integer division
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return normalizeBigInt(new(big.Int).Quo(leftVal, rightVal))
+	// Modulo, truncated like integer modulo
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+		return normalizeBigInt(new(big.Int).Rem(leftVal, rightVal))
+	// Less than
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	// Greater than
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	// Less than or equal
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	// Greater than or equal
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	// Equality
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	// Inequality
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	// Bitwise operators, on the two's complement of the values
+	case "&":
+		return normalizeBigInt(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return normalizeBigInt(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return normalizeBigInt(new(big.Int).Xor(leftVal, rightVal))
+	// Shifts
+	case "<<", ">>":
+		return shiftBigInt(operator, leftVal, rightVal)
+	// If the operator is anything else, return an error
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// Largest left shift of a big integer, which keeps a single shift from
+// allocating an unbounded amount of memory
+const maxShiftCount = 1 << 20
+
+// Helper function to shift a big integer
+func shiftBigInt(operator string, value, count *big.Int) object.Object {
+	if count.Sign() < 0 {
+		return newError("negative shift count: %s", count)
+	}
+
+	// Zero stays zero however far it is shifted
+	if value.Sign() == 0 {
+		return &object.Integer{Value: 0}
+	}
+
+	if operator == "<<" {
+		if count.Cmp(big.NewInt(maxShiftCount)) > 0 {
+			return newError("shift count too large: %s", count)
+		}
+		return normalizeBigInt(new(big.Int).Lsh(value, uint(count.Int64())))
+	}
+
+	// Shifting right by the length of the value or more leaves its sign
+	n := uint(value.BitLen())
+	if count.IsUint64() && count.Uint64() < uint64(n) {
+		n = uint(count.Uint64())
+	}
+	return normalizeBigInt(new(big.Int).Rsh(value, n))
+}
+
+// Helper function to check if an object is an Integer or a BigInt
+func isInteger(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// Helper function to convert an Integer or BigInt to a big.Int
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
+// Helper function to demote a big integer to an Integer when it fits
+func normalizeBigInt(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+	return &object.BigInt{Value: value}
+}
+
+// Helper functions to do int64 arithmetic, reporting false on overflow
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, false
+	}
+	return c, true
+}
+
+func subInt64(a, b int64) (int64, bool) {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return 0, false
+	}
+	return c, true
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) || c/b != a {
+		return 0, false
+	}
+	return c, true
+}
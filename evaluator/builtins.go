@@ -1,17 +1,46 @@
 package evaluator
 
-import "github.com/rielj/go-interpreter/object"
-
-var builtins = map[string]*object.Builtin{
-	"len":   {Fn: builtinLen},
-	"first": {Fn: builtinFirst},
-	"last":  {Fn: builtinLast},
-	"rest":  {Fn: builtinRest},
-	"push":  {Fn: builtinPush},
-	"puts":  {Fn: builtinPuts},
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rielj/go-interpreter/object"
+)
+
+// Builtins lists the builtin functions in a fixed order, so that compiled
+// code can refer to them by index
+var Builtins = []struct {
+	Name    string
+	Builtin *object.Builtin
+}{
+	{"len", &object.Builtin{Fn: builtinLen}},
+	{"first", &object.Builtin{Fn: builtinFirst}},
+	{"last", &object.Builtin{Fn: builtinLast}},
+	{"rest", &object.Builtin{Fn: builtinRest}},
+	{"push", &object.Builtin{Fn: builtinPush}},
+	{"puts", &object.Builtin{Fn: builtinPuts}},
+	{"range", &object.Builtin{Fn: builtinRange}},
+	{"int", &object.Builtin{Fn: builtinInt}},
+	{"float", &object.Builtin{Fn: builtinFloat}},
+	{"chars", &object.Builtin{Fn: builtinChars}},
+	{"runeLen", &object.Builtin{Fn: builtinRuneLen}},
 }
 
-// builtinLen
+// builtins indexes the builtin functions by name
+var builtins = map[string]*object.Builtin{}
+
+func init() {
+	for _, def := range Builtins {
+		builtins[def.Name] = def.Builtin
+	}
+}
+
+// builtinLen returns the number of elements of an array, or the number of
+// bytes of a string in UTF-8. Use runeLen to count the characters.
 func builtinLen(args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newError("wrong number of arguments. got=%d, want=1",
@@ -104,7 +133,121 @@ func builtinPush(args ...object.Object) object.Object {
 // builtinPuts
 func builtinPuts(args ...object.Object) object.Object {
 	for _, arg := range args {
-		println(arg.Inspect())
+		fmt.Println(arg.Inspect())
 	}
 	return NULL
 }
+
+// builtinRange
+func builtinRange(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1..3",
+			len(args))
+	}
+	bounds := []int64{}
+	for _, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("argument to `range` must be INTEGER, got %s",
+				arg.Type())
+		}
+		bounds = append(bounds, integer.Value)
+	}
+	switch len(bounds) {
+	case 1:
+		return &object.Range{Start: 0, End: bounds[0], Step: 1}
+	case 2:
+		return &object.Range{Start: bounds[0], End: bounds[1], Step: 1}
+	default:
+		if bounds[2] == 0 {
+			return newError("`range` step must not be zero")
+		}
+		return &object.Range{Start: bounds[0], End: bounds[1], Step: bounds[2]}
+	}
+}
+
+// builtinInt
+func builtinInt(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return arg
+	case *object.Float:
+		// Truncate towards zero
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		value, _ := big.NewFloat(arg.Value).Int(nil)
+		return normalizeBigInt(value)
+	case *object.String:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+		if !ok {
+			return newError("cannot convert %q to INTEGER", arg.Value)
+		}
+		return normalizeBigInt(value)
+	default:
+		return newError("argument to `int` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinFloat
+func builtinFloat(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return &object.Float{Value: toFloat(arg)}
+	case *object.Float:
+		return arg
+	case *object.String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError("cannot convert %q to FLOAT", arg.Value)
+		}
+		return &object.Float{Value: value}
+	default:
+		return newError("argument to `float` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinChars returns the characters of a string as an array of strings.
+// Invalid UTF-8 bytes become U+FFFD.
+func builtinChars(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `chars` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]object.Object, 0, utf8.RuneCountInString(str.Value))
+	for _, ch := range str.Value {
+		elements = append(elements, &object.String{Value: string(ch)})
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinRuneLen returns the number of characters of a string, counting
+// every invalid UTF-8 byte as one character
+func builtinRuneLen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `runeLen` must be STRING, got %s",
+			args[0].Type())
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(str.Value))}
+}
@@ -1,41 +1,113 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 
 	"github.com/rielj/go-interpreter/ast"
 	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/token"
 )
 
 var (
 	// Singleton objects
 	// TRUE
-	TRUE = &object.Boolean{Value: true}
+	TRUE = object.TRUE
 	// FALSE
-	FALSE = &object.Boolean{Value: false}
+	FALSE = object.FALSE
 	// NULL
-	NULL = &object.Null{}
+	NULL = object.NULL
+	// BREAK
+	BREAK = &object.Break{}
+	// CONTINUE
+	CONTINUE = &object.Continue{}
 )
 
+// Eval evaluates the node in the environment. Go panics raised during
+// evaluation are turned into runtime errors, so that a bug in the evaluator
+// or a builtin cannot take down the host process.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env, Limits{})
+}
+
+// EvalContext evaluates the node like Eval, but gives up with an error of
+// the matching kind once ctx is done or the evaluation exceeds its limits.
+// Use it to run programs that cannot be trusted to terminate.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return run(ctx, limits, func(e *evaluator) object.Object {
+		return e.eval(node, env)
+	})
+}
+
+// ApplyContext calls a function with the arguments, stopping like
+// EvalContext does. It lets a host call back into a Monkey program.
+func ApplyContext(ctx context.Context, fn object.Object, args []object.Object, limits Limits) object.Object {
+	return run(ctx, limits, func(e *evaluator) object.Object {
+		return e.applyFunction(fn, args, token.Position{})
+	})
+}
+
+// Helper function to run an evaluation, turning Go panics into errors
+func run(ctx context.Context, limits Limits, f func(e *evaluator) object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
+	}()
+
+	e := newEvaluator(ctx, limits)
+	if err := e.checkContext(); err != nil {
+		return err
+	}
+	return f(e)
+}
+
+// Helper function to evaluate a node and record where errors happened
+func (e *evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := e.step(); err != nil {
+		result = err
+	} else {
+		result = e.evalNode(node, env)
+	}
+
+	// Errors point at the innermost node that produced them
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+// Helper function to evaluate a single node
+func (e *evaluator) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	// Expressions
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 	// Integer
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	// Float
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	// Boolean
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	// Prefix expressions
 	case *ast.PrefixExpression:
 		// Evaluate the right side of the expression
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		// Evaluate the prefix operator
@@ -43,44 +115,73 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	// Infix expressions
 	case *ast.InfixExpression:
 		// Evaluate the left side of the expression
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := e.eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
+		// Logical operators return the left side if it decides the result,
+		// without evaluating the right side
+		if node.Operator == "&&" || node.Operator == "||" {
+			if isTruthy(left) == (node.Operator == "||") {
+				return left
+			}
+			return e.eval(node.Right, env)
+		}
 		// Evaluate the right side of the expression
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		// Evaluate the infix operator
-		return evalInfixExpression(node.Operator, left, right)
+		return e.evalInfix(node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	// If statements
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	// Loops
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	// Return statements
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := e.eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	// Let statements
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := e.eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
+		// Name anonymous functions after their first binding
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
 		env.Set(node.Name.Value, val)
 		// Add the evaluated value to the environment
 		// This is how we implement variable bindings
 
+	// Import statements
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node, env)
+
 	// Identifiers
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
+	// Assignments
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
+
 	// Function literals
 	case *ast.FunctionLiteral:
 		// Return a Function object
@@ -94,72 +195,117 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	// Interpolated strings
+	case *ast.InterpolatedString:
+		// Evaluate the text and the embedded expressions
+		parts := e.evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isAbrupt(parts[0]) {
+			return parts[0]
+		}
+		str := interpolate(parts)
+		if err := e.allocate(sizeOf(str)); err != nil {
+			return err
+		}
+		return str
+
 	// Array literals
 	case *ast.ArrayLiteral:
 		// Evaluate each element of the array
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 		// Return an Array object
-		return &object.Array{Elements: elements}
+		array := &object.Array{Elements: elements}
+		if err := e.allocate(sizeOf(array)); err != nil {
+			return err
+		}
+		return array
 
 	// Index expressions
 	case *ast.IndexExpression:
 		// Evaluate the left side of the expression
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := e.eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
 		// Evaluate the index
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := e.eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
 		// Return the evaluated index expression
 		return evalIndexExpression(left, index)
 
+	// Member expressions
+	case *ast.MemberExpression:
+		left := e.eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		return evalMemberExpression(left, node.Member)
+
 	// Hash literals
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 
 	// Call expressions
 	case *ast.CallExpression:
 		// Evaluate the function
-		function := Eval(node.Function, env)
-		if isError(function) {
+		function := e.eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
 		// Evaluate the arguments
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
 		// Call the function
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, node.Pos())
 	}
 
 	return nil
 }
 
 // Helper function to apply functions
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *evaluator) applyFunction(fn object.Object, args []object.Object, callSite token.Position) object.Object {
 	switch fn := fn.(type) {
 	// Function object
 	case *object.Function:
 		// Extend the environment for the function
-		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		// Evaluate the function body
-		evaluated := Eval(fn.Body, extendedEnv)
+		if err := e.enterCall(); err != nil {
+			return err
+		}
+		evaluated := e.eval(fn.Body, extendedEnv)
+		e.leaveCall()
+		// Record the call in the stack trace of errors leaving the function
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.Frame{Function: fn.Name, CallSite: callSite})
+			return err
+		}
 		// Unwrap the return value
 		return unwrapReturnValue(evaluated)
 	// Builtin function
 	case *object.Builtin:
 		// Call the builtin function
-		return fn.Fn(args...)
+		result := fn.Fn(args...)
+		// Only new strings, arrays and hashes count, and only against a limit,
+		// since looking for the result among the arguments takes a while
+		if e.limits.MaxMemory > 0 && sizeOf(result) > 0 && isAllocated(result, args) {
+			if err := e.allocate(sizeOf(result)); err != nil {
+				return err
+			}
+		}
+		return result
 	// Otherwise, return an error
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -167,7 +313,13 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 }
 
 // Helper function to extend the environment for a function
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
+	// Every parameter needs exactly one argument
+	if len(args) != len(fn.Parameters) {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), len(fn.Parameters))
+	}
+
 	// Create a new environment
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -176,7 +328,7 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 		env.Set(param.Value, args[paramIdx])
 	}
 
-	return env
+	return env, nil
 }
 
 // Helper function to unwrap return values
@@ -189,16 +341,113 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+// Helper function to evaluate assignment expressions
+func (e *evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	// Rebind a name in the scope that declares it
+	case *ast.Identifier:
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newError("assignment to undeclared identifier: %s", target.Value)
+		}
+		return val
+
+	// Store into an array element or hash pair
+	case *ast.IndexExpression:
+		left := e.eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := e.eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		// New hash pairs count as allocations
+		if err := e.allocate(assignmentSize(left, index)); err != nil {
+			return err
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// Helper function to evaluate the value of an assignment. For compound
+// assignments such as += the operator is applied to the current value.
+func (e *evaluator) evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := e.eval(node.Value, env)
+	if isAbrupt(val) || node.Operator == "=" {
+		return val
+	}
+
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return e.evalInfix(operator, current, val)
+}
+
+// Helper function to store a value at an index of an array or hash
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		idx := integer.Value
+		if idx < 0 || idx >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx)
+		}
+		left.Elements[idx] = val
+		return val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
 // Helper function to evaluate hash literals
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	// Create a new hash map
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	// Evaluate each key-value pair
 	for keyNode, valueNode := range node.Pairs {
 		// Evaluate the key
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := e.eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -209,8 +458,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		}
 
 		// Evaluate the value
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := e.eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -220,7 +469,11 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	}
 
 	// Return a Hash object
-	return &object.Hash{Pairs: pairs}
+	hash := &object.Hash{Pairs: pairs}
+	if err := e.allocate(sizeOf(hash)); err != nil {
+		return err
+	}
+	return hash
 }
 
 // Helper function to evaluate index expressions
@@ -271,13 +524,13 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 }
 
 // Helper function to evaluate expressions
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	// Evaluate each expression
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		// Add the evaluated expression to the result
@@ -306,12 +559,12 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 }
 
 // Helper function to evaluate programs
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	// Evaluate each statement in the program
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.eval(statement, env)
 
 		switch result := result.(type) {
 		// If the result is an Error object, return the error
@@ -330,12 +583,12 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 }
 
 // Helper function to evaluate block statements
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	// Evaluate each statement in the block
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.eval(statement, env)
 
 		// If the result is a ReturnValue object, return the value
 		if result != nil {
@@ -343,9 +596,19 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
 				return result
 			}
+			// Leave the block early to break out of or continue a loop
+			if rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
+				return result
+			}
 		}
 	}
 
+	// Blocks that end without a value, such as an empty function body,
+	// evaluate to NULL
+	if result == nil {
+		return NULL
+	}
+
 	return result
 }
 
@@ -366,6 +629,9 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	// If the operator is "-", return the result of the minus operator
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	// If the operator is "~", return the bitwise complement
+	case "~":
+		return evalBitwiseNotExpression(right)
 	// If the operator is anything else, return an error
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
@@ -381,6 +647,12 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	// If the left and right sides are both integers, evaluate the integer expression
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	// If either side is a big integer, evaluate the big integer expression
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	// If either side is a float and the other is a number, evaluate the float expression
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	// If the left and right sides are both booleans, evaluate the boolean expression
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
@@ -399,15 +671,43 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 
 // Helper function to evaluate string infix expressions
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	// If the operator is "+", concatenate the strings
-	if operator != "+" {
+	// Get the values of the left and right sides
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	// Strings are ordered byte by byte
+	switch operator {
+	// Concatenation
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	// Comparisons
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	// If the operator is anything else, return an error
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-	// Otherwise, concatenate the strings
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+}
+
+// Helper function to join the parts of an interpolated string. Every value
+// is converted with Inspect, so strings are inserted without quotes.
+func interpolate(parts []object.Object) *object.String {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return &object.String{Value: out.String()}
 }
 
 // Helper function to evaluate integer infix expressions
@@ -420,28 +720,81 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	switch operator {
 	// Addition
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		if sum, ok := addInt64(leftVal, rightVal); ok {
+			return &object.Integer{Value: sum}
+		}
+		// Promote to a big integer on overflow
+		return evalBigIntInfixExpression(operator, left, right)
 	// Subtraction
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		if diff, ok := subInt64(leftVal, rightVal); ok {
+			return &object.Integer{Value: diff}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
 	// Multiplication
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		if product, ok := mulInt64(leftVal, rightVal); ok {
+			return &object.Integer{Value: product}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
 	// Division
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		// The only overflowing division is math.MinInt64 / -1
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	// Modulo, with the sign of the left side like integer division
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	// Less than
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	// Greater than
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	// Less than or equal
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	// Greater than or equal
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	// Equality
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	// Inequality
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	// Bitwise and, or and exclusive or
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	// Left shift, promoted to a big integer if bits are shifted out
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if rightVal < 64 {
+			if shifted := leftVal << rightVal; shifted>>rightVal == leftVal {
+				return &object.Integer{Value: shifted}
+			}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	// Arithmetic right shift, which keeps the sign
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	// If the operator is anything else, return NULL
 	default:
 		return newError("unknown operator: %s %s %s",
@@ -449,6 +802,80 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+// Helper function to evaluate float infix expressions. Integer operands are
+// converted to floats first.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	// Get the values of the left and right sides
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	// Evaluate the float expression based on the operator
+	switch operator {
+	// Addition
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	// Subtraction
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	// Multiplication
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	// Division
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	// Floating point remainder, with the sign of the left side
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	// Less than
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	// Greater than
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	// Less than or equal
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	// Greater than or equal
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	// Equality
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	// Inequality
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	// If the operator is anything else, return an error
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// Helper function to check if an object is an integer or a float
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInt, *object.Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// Helper function to convert a number to a Go float
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 // Helper function to evaluate bang operator expressions
 func evalBangOperatorExpression(right object.Object) object.Object {
 	// If the right side is TRUE, return FALSE
@@ -469,34 +896,145 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 // Helper function to evaluate minus prefix operator expressions
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	// If the right side is not an integer, return NULL
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	// Return the negative of the integer
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return normalizeBigInt(new(big.Int).Neg(toBigInt(right)))
+		}
+		return &object.Integer{Value: -right.Value}
+	// Return the negative of the big integer
+	case *object.BigInt:
+		return normalizeBigInt(new(big.Int).Neg(right.Value))
+	// Return the negative of the float
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	// If the right side is not a number, return an error
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	// Otherwise, return the negative of the integer
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+}
+
+// Helper function to evaluate the bitwise complement of an integer
+func evalBitwiseNotExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return normalizeBigInt(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
 }
 
 // Helper function to evaluate if expressions
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+func (e *evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	// Evaluate the condition
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	condition := e.eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 	// If the condition is TRUE, evaluate the consequence
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.eval(ie.Consequence, env)
 		// If the condition is FALSE, evaluate the alternative
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.eval(ie.Alternative, env)
 		// If there is no alternative, return NULL
 	} else {
 		return NULL
 	}
 }
 
+// Helper function to evaluate while loops
+func (e *evaluator) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		// Evaluate the condition
+		condition := e.eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		// Stop once the condition is falsy
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		// Evaluate the body
+		result := e.eval(ws.Body, env)
+		if stop, result := loopControl(result); stop {
+			return result
+		}
+	}
+}
+
+// Helper function to evaluate for loops
+func (e *evaluator) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	// Evaluate the iterable
+	iterable := e.eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	var result object.Object = NULL
+
+	// Bind each element in a fresh scope, so closures created in the body
+	// capture the element of their own iteration
+	err := iterate(iterable, func(elem object.Object) bool {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, elem)
+
+		var stop bool
+		stop, result = loopControl(e.eval(fs.Body, loopEnv))
+		return !stop
+	})
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+// Helper function to call fn for every element of an iterable until fn
+// returns false
+func iterate(iterable object.Object, fn func(object.Object) bool) *object.Error {
+	next, err := NewIterator(iterable)
+	if err != nil {
+		return err
+	}
+	for elem, ok := next(); ok; elem, ok = next() {
+		if !fn(elem) {
+			break
+		}
+	}
+	return nil
+}
+
+// Helper function to check if an integer is inside a range
+func inRange(r *object.Range, i int64) bool {
+	if r.Step > 0 {
+		return i < r.End
+	}
+	return i > r.End
+}
+
+// Helper function to handle the result of a loop body. It reports whether
+// the loop has to stop and the value the loop statement evaluates to.
+func loopControl(result object.Object) (bool, object.Object) {
+	if result == nil {
+		return false, NULL
+	}
+
+	switch result.Type() {
+	// Return values and errors leave the loop and keep propagating
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return true, result
+	case object.BREAK_OBJ:
+		return true, NULL
+	default:
+		return false, NULL
+	}
+}
+
 // Helper function to determine if an object is truthy
 func isTruthy(obj object.Object) bool {
 	// TRUE and FALSE are truthy and falsy, respectively
@@ -518,6 +1056,21 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// Helper function to check if an object ends the evaluation of the
+// expression it was produced in: an error, or a return, break or continue
+// that has to reach the enclosing function or loop
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
 func isError(obj object.Object) bool {
 	// If the object is not nil and its type is ERROR_OBJ, it is an error
 	if obj != nil {
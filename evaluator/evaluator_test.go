@@ -1,7 +1,12 @@
 package evaluator
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rielj/go-interpreter/lexer"
 	"github.com/rielj/go-interpreter/object"
@@ -20,6 +25,29 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"5 + 5 + 5 + 5 - 10", 10},
 		{"2 * 2 * 2 * 2 * 2", 32},
 		{"-50 + 100 + -50", 0},
+		{"0xff + 0o10 + 0b11", 266},
+		{"1_000 * 1_000", 1000000},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 10 % 4 * 3", 8},
+		{"0xf0 | 0x0f", 255},
+		{"0b1100 & 0b1010", 8},
+		{"0b1100 ^ 0b1010", 6},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-1 << 63", -9223372036854775808},
+		{"1024 >> 3", 128},
+		{"-16 >> 2", -4},
+		{"5 >> 64", 0},
+		{"-5 >> 64", -1},
+		{"(1 << 64) >> 60", 16},
+		{"0 << 2000000", 0},
+		{"0 << (1 << 64)", 0},
+		{"~(1 << 64) & 0xff", 255},
+		{"((1 << 64) | 3) & 0b101", 1},
+		{"1 | 6 & 3 ^ 8", 11},
 		{"5 * 2 + 10", 20},
 		{"5 + 2 * 10", 25},
 		{"20 + 2 * -10", 0},
@@ -66,6 +94,25 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 2", true},
+		{"2 >= 1.5", true},
+		{"100000000000000000000 >= 1", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"apple" < "banana"`, true},
+		{`"b" > "abc"`, true},
+		{`"ab" <= "ab"`, true},
+		{`"ab" >= "abc"`, false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -243,6 +290,17 @@ func TestErrorHandling(t *testing.T) {
 		{"foobar", "identifier not found: foobar"},
 		// Error handling
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"5 % 0", "modulo by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -2", "negative shift count: -2"},
+		{"(1 << 64) << -1", "negative shift count: -1"},
+		{"1 << (1 << 64)", "shift count too large: 18446744073709551616"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"true | false", "unknown operator: BOOLEAN | BOOLEAN"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"100000000000000000000 % 0", "modulo by zero"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
+		{"true && 1 + true", "type mismatch: INTEGER + BOOLEAN"},
 		// Error handling
 		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
 	}
@@ -356,6 +414,37 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+// Test interpolated strings
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let count = 3; "total: ${count * 2} items"`, "total: 6 items"},
+		{`let name = "monkey"; "hi ${name}!"`, "hi monkey!"},
+		{`"${1.5} ${true} ${[1, "a"]} ${len}"`, "1.5 true [1, a] builtin function"},
+		{`"outer ${"inner ${1 + 1}"}"`, "outer inner 2"},
+		{`"${1 + true}"`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
 // Test string concatenation
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
@@ -374,6 +463,42 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+// Test that && and || return the operand that decides the result and
+// only evaluate the right side when they have to
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`false && missing`, false},
+		{`if (false) { 1 } && missing`, nil},
+		{`true || missing`, true},
+		{`1 || missing`, 1},
+		{`true && 5`, 5},
+		{`false || "x"`, "x"},
+		{`if (false) { 1 } || false`, false},
+		{`let calls = 0; let f = fn() { calls += 1; true }; false && f(); true || f(); calls`, 0},
+		{`let calls = 0; let f = fn() { calls += 1; true }; true && f(); false || f(); calls`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: wrong result. expected=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 // Test builtin functions
 func TestBuiltinFunctions(t *testing.T) {
 	// Builtin functions
@@ -391,6 +516,20 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		// Len
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		// Len counts bytes
+		{`len("héllo")`, 6},
+		// RuneLen counts characters
+		{`runeLen("héllo")`, 5},
+		// RuneLen
+		{`runeLen("👋🌍")`, 2},
+		// RuneLen
+		{`runeLen([])`, "argument to `runeLen` must be STRING, got ARRAY"},
+		// Chars
+		{`len(chars("größe"))`, 5},
+		// Chars
+		{`chars("größe")[2]`, "ö"},
+		// Chars
+		{`chars(1)`, "argument to `chars` must be STRING, got INTEGER"},
 	}
 
 	for _, tt := range tests {
@@ -403,6 +542,12 @@ func TestBuiltinFunctions(t *testing.T) {
 			testIntegerObject(t, evaluated, int64(expected))
 		// String
 		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+				}
+				continue
+			}
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
 				t.Errorf("object is not Error. got=%T (%+v)",
@@ -573,3 +718,610 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+// Test runtime error positions and stack traces
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn() {
+	x + 1;
+};
+let outer = fn() { inner() };
+outer();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "identifier not found: x" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	if errObj.Pos.String() != "2:2" {
+		t.Errorf("wrong error position. got=%s", errObj.Pos)
+	}
+
+	expected := []object.Frame{
+		{Function: "inner"},
+		{Function: "outer"},
+	}
+	expectedCallSites := []string{"4:20", "5:1"}
+
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. got=%+v", errObj.Stack)
+	}
+
+	for i, frame := range errObj.Stack {
+		if frame.Function != expected[i].Function {
+			t.Errorf("stack[%d] wrong function. expected=%q, got=%q",
+				i, expected[i].Function, frame.Function)
+		}
+		if frame.CallSite.String() != expectedCallSites[i] {
+			t.Errorf("stack[%d] wrong call site. expected=%s, got=%s",
+				i, expectedCallSites[i], frame.CallSite)
+		}
+	}
+
+	trace := "    at 2:2\n    in inner called at 4:20\n    in outer called at 5:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. expected=%q, got=%q", trace, errObj.StackTrace())
+	}
+}
+
+// Test while loops
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (false) { 1 }", nil},
+		{"let f = fn(n) { let i = 0; while (true) { return n; } }; f(5)", 5},
+		{"let f = fn() { while (true) { break; } 3 }; f()", 3},
+		{"while (true) { x }", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// Test for loops
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn() { let out = []; for (x in [1, 2, 3]) { return x * 10 } }; f()`, 10},
+		{`let last = fn(xs) { let r = 0; for (x in xs) { if (x > 2) { return x } } }; last([1, 2, 3, 4])`, 3},
+		{`let f = fn() { for (i in range(10)) { if (i < 7) { continue; } return i; } }; f()`, 7},
+		{`let f = fn() { for (i in range(10, 0, -3)) { if (i < 5) { return i; } } }; f()`, 4},
+		// Ranges stop before their counter overflows
+		{"let n = 0; for (i in range(9223372036854775800, 9223372036854775807, 2)) { n += 1 } n", 4},
+		{"let n = 0; for (i in range(-9223372036854775801, -9223372036854775807 - 1, -3)) { n += 1 } n", 3},
+		{`let f = fn() { for (k in {"b": 2, "a": 1}) { return k; } }; f()`, "a"},
+		{`let f = fn() { for (c in "xyz") { return c; } }; f()`, "x"},
+		{`for (x in []) { x }`, nil},
+		{`for (x in [1, 2]) { break; }`, nil},
+		{`for (x in 5) { x }`, "not iterable: INTEGER"},
+		// Break, continue and return leave the expressions they appear in
+		{`let n = 0; for (x in [1, 2]) { let y = if (true) { break } else { 1 }; n += 1 } n`, 0},
+		{`let s = 0; for (x in [1, 2, 3, 4]) { s += if (x > 2) { break } else { x } } s`, 3},
+		{`let s = 0; for (x in [1, 2, 3]) { s += [x, if (x == 2) { continue } else { x }][1] } s`, 4},
+		{`let id = fn(v) { v }; let n = 0; for (x in [1, 2]) { id(if (x == 1) { continue } else { x }); n += x } n`, 2},
+		{`let i = 0; while (i < 5) { i += 1; let a = {i: if (i < 3) { continue } else { i }}; break } i`, 3},
+		{`let f = fn() { let y = if (true) { return 5 } else { 1 }; 10 }; f()`, 5},
+		{`let f = fn() { -if (true) { return 5 } else { 1 } }; f()`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// Test assignment expressions
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let a = 1; let b = 2; a = b = 7; a + b", 14},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 0; for (i in range(5)) { x += i }; x", 10},
+		{"let i = 0; while (i < 10) { i += 1; if (i > 4) { break; } }; i", 5},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[1]", 20},
+		{"let arr = [1, 2, 3]; arr[2] *= 5; arr[2]", 15},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`, 13},
+		{"y = 5", "assignment to undeclared identifier: y"},
+		{"let f = fn() { let z = 1 }; f(); z = 2", "assignment to undeclared identifier: z"},
+		{"y += 5", "identifier not found: y"},
+		{"let arr = [1]; arr[3] = 1", "index out of range: 3"},
+		{`let arr = [1]; arr["a"] = 1`, "array index must be INTEGER, got STRING"},
+		{`let s = "a"; s[0] = 1`, "index assignment not supported: STRING"},
+		{`let x = "a"; x += 1`, "type mismatch: STRING + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// Test float arithmetic and comparison
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999.0},
+		{"let x = 1; x += 0.5; x", 1.5},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"2 == 2.0", true},
+		{"0.1 != 0.1", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+// Test int and float conversion builtins
+func TestNumberConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.9)", int64(3)},
+		{"int(-3.9)", int64(-3)},
+		{"int(7)", int64(7)},
+		{`int("42")`, int64(42)},
+		{"float(2)", 2.0},
+		{`float("2.5")`, 2.5},
+		{`int("abc")`, `cannot convert "abc" to INTEGER`},
+		{`int(float("nan"))`, "cannot convert NaN to INTEGER"},
+		{"float(true)", "argument to `float` not supported, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func testBigIntObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.BigInt)
+	if !ok {
+		t.Errorf("object is not BigInt. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value.String() != expected {
+		t.Errorf("object has wrong value. got=%s, want=%s",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// Test promotion to and demotion from big integers
+func TestBigIntegers(t *testing.T) {
+	factorial := `let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{factorial + "fact(20)", int64(2432902008176640000)},
+		{factorial + "fact(21)", "51090942171709440000"},
+		{factorial + "fact(25) / fact(23)", int64(600)},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"9223372036854775808 - 1", int64(9223372036854775807)},
+		{"-9223372036854775807 - 1", int64(-9223372036854775807 - 1)},
+		{"let m = -9223372036854775807 - 1; -m", "9223372036854775808"},
+		{"let m = -9223372036854775807 - 1; m / -1", "9223372036854775808"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"100000000000000000000000 * 0", int64(0)},
+		{"-100000000000000000000000", "-100000000000000000000000"},
+		{"100000000000000000000000 > 5", true},
+		{"5 == 100000000000000000000000", false},
+		{"100000000000000000000000 == 100000000000000000000000", true},
+		{"100000000000000000000000 * 0.5", 5e22},
+		{`int("100000000000000000000000")`, "100000000000000000000000"},
+		{"int(1e20)", "100000000000000000000"},
+		{`{100000000000000000000000: 1}[100000000000000000000000]`, int64(1)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case string:
+			testBigIntObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+// Test errors that used to crash the host process
+func TestRuntimeErrorsInsteadOfPanics(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrMsg string
+	}{
+		{"1 / 0", "division by zero"},
+		{"let x = 5; x /= 0", "division by zero"},
+		{"100000000000000000000000 / 0", "division by zero"},
+		{"fn(a, b) { a + b }(1)", "wrong number of arguments. got=1, want=2"},
+		{"fn() { 1 }(1, 2)", "wrong number of arguments. got=2, want=0"},
+		{"let f = fn(n) { 10 / n }; let g = fn() { f(0) }; g()", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedErrMsg {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedErrMsg, errObj.Message)
+		}
+	}
+}
+
+// Test that unexpected Go panics become runtime errors
+func TestEvalRecoversFromPanics(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("boom", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		panic("something went wrong")
+	}})
+
+	l := lexer.New("boom()")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	evaluated := Eval(program, env)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "internal error: something went wrong" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+// Test that programs are stopped once they exceed their limits
+func TestEvalContextLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		ctx             context.Context
+		limits          Limits
+		input           string
+		expectedKind    object.ErrorKind
+		expectedMessage string
+	}{
+		{context.Background(), Limits{MaxSteps: 1000}, "while (true) {}", object.STEP_LIMIT_ERROR, "step limit exceeded: 1000 steps"},
+		{context.Background(), Limits{}, "let f = fn(n) { f(n + 1) }; f(0)", object.STACK_OVERFLOW_ERROR, "stack overflow"},
+		{context.Background(), Limits{MaxDepth: 10}, "let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.STACK_OVERFLOW_ERROR, "stack overflow"},
+		{cancelled, Limits{}, "1 + 1", object.CANCELLED_ERROR, "execution cancelled"},
+		{timeout, Limits{}, "let i = 0; while (true) { i += 1 }", object.TIMEOUT_ERROR, "execution timed out"},
+		{context.Background(), Limits{MaxMemory: 1 << 20}, `let s = "x"; while (true) { s += s }`, object.MEMORY_LIMIT_ERROR, "memory limit exceeded: 1048576 bytes"},
+		{context.Background(), Limits{MaxMemory: 1 << 16}, "let f = fn(a) { f(push(a, a)) }; f([])", object.MEMORY_LIMIT_ERROR, "memory limit exceeded: 65536 bytes"},
+		{context.Background(), Limits{MaxMemory: 1 << 16}, "let h = {}; let i = 0; while (true) { h[i] = [i]; i += 1 }", object.MEMORY_LIMIT_ERROR, "memory limit exceeded: 65536 bytes"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(tt.ctx, program, object.NewEnvironment(), tt.limits)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error for %q. expected=%q (%s), got=%q (%s)",
+				tt.input, tt.expectedMessage, tt.expectedKind, errObj.Message, errObj.Kind)
+		}
+	}
+}
+
+// Test that programs within their limits run as usual
+func TestEvalContextWithinLimits(t *testing.T) {
+	input := `let f = fn(n) { if (n > 0) { f(n - 1) } else { len(push([1], "abc" + "d")) } }; f(10)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(),
+		Limits{MaxSteps: 1000, MaxDepth: 11, MaxMemory: 1000})
+	testIntegerObject(t, evaluated, 2)
+}
+
+// Test that stack traces of deep recursions leave out the middle
+func TestStackOverflowTrace(t *testing.T) {
+	evaluated := testEval("let f = fn(n) { f(n + 1) }; f(0)")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if len(errObj.Stack) != DefaultMaxDepth {
+		t.Errorf("wrong number of frames. expected=%d, got=%d", DefaultMaxDepth, len(errObj.Stack))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(errObj.StackTrace(), "\n"), "\n")
+	if len(lines) != 22 {
+		t.Fatalf("wrong number of lines in the stack trace. got=%d", len(lines))
+	}
+	if lines[11] != "    ... 9980 more calls" {
+		t.Errorf("wrong elision line. got=%q", lines[11])
+	}
+}
+
+// Test that blocks without a value evaluate to NULL
+func TestEmptyBlocks(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"fn() { let a = 1; }()",
+		"let x = if (true) { let a = 1; }; x",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+// Test importing modules from files
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	libDir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"math.mk":         "let square = fn(x) { x * x }; let state = {\"n\": 0};",
+		"util.mk":         `import "helpers/text" as text; let greet = fn(name) { text.join("hi ", name) };`,
+		"helpers/text.mk": "let join = fn(a, b) { a + b };",
+		"a.mk":            `import "b.mk"; let x = 1;`,
+		"b.mk":            `import "a.mk"; let y = 2;`,
+		"broken.mk":       "let f = fn() { 1 + true };\nlet x = f();",
+		"syntax.mk":       "let = 1;",
+		"dashed-name.mk":  "let x = 1;",
+	})
+	writeFiles(t, libDir, map[string]string{
+		"extra.mk": `let where = "lib";`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "math.mk"; math.square(4)`, 16},
+		{`import "math" as m; m.square(3)`, 9},
+		{`import "util"; util.greet("monkey")`, "hi monkey"},
+		{`import "extra"; extra.where`, "lib"},
+		// Modules are evaluated once and shared by all imports
+		{`import "math" as a; import "math.mk" as b; a.state["n"] = 5; b.state["n"]`, 5},
+		// Errors
+		{`import "missing"`, `module not found: "missing"`},
+		{`import "math"; math.cube`, "module math has no member cube"},
+		{`let x = 1; x.y`, "member access not supported: INTEGER"},
+		{`import "a"`, "import cycle: a.mk -> b.mk -> a.mk"},
+		{`import "dashed-name"`, `cannot bind module "dashed-name" to "dashed-name", rename it with as`},
+		{`import "dashed-name" as d; d.x`, 1},
+		// Modules are named after their file, not after their first binding
+		{`import "math" as m; import "math"; "${math}"`, "module math"},
+		{`import "syntax"`, "syntax error in module syntax: " + filepath.Join(dir, "syntax.mk") + ":1:5: expected next token to be IDENT, got = instead"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.NewFile(filepath.Join(dir, "main.mk"), tt.input)).ParseProgram()
+		ctx := WithImporter(context.Background(), NewImporter(libDir))
+		evaluated := EvalContext(ctx, program, object.NewEnvironment(), Limits{})
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%T(%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+
+	// Errors in a module point into the module and record the import
+	program := parser.New(lexer.NewFile(filepath.Join(dir, "main.mk"), `import "broken";`)).ParseProgram()
+	evaluated := EvalContext(WithImporter(context.Background(), NewImporter()), program, object.NewEnvironment(), Limits{})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	broken := filepath.Join(dir, "broken.mk")
+	trace := "    at " + broken + ":1:16\n" +
+		"    in f called at " + broken + ":2:9\n" +
+		"    in module broken called at " + filepath.Join(dir, "main.mk") + ":1:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. expected=%q, got=%q", trace, errObj.StackTrace())
+	}
+}
+
+// Test that a module whose evaluation panics can be imported again
+func TestImportAfterPanic(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"flaky.mk": "let x = boom();"})
+
+	fail := true
+	builtins["boom"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if fail {
+			panic("something went wrong")
+		}
+		return &object.Integer{Value: 1}
+	}}
+	t.Cleanup(func() { delete(builtins, "boom") })
+
+	importer := NewImporter()
+	run := func() object.Object {
+		program := parser.New(lexer.NewFile(filepath.Join(dir, "main.mk"), `import "flaky"; flaky.x`)).ParseProgram()
+		return EvalContext(WithImporter(context.Background(), importer), program, object.NewEnvironment(), Limits{})
+	}
+
+	if errObj, ok := run().(*object.Error); !ok || errObj.Message != "internal error: something went wrong" {
+		t.Fatalf("expected the panic as an error. got=%v", errObj)
+	}
+
+	fail = false
+	testIntegerObject(t, run(), 1)
+}
+
+// Test that a module importing the running script back is a cycle
+func TestImportEntryCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"ca.mk": `let runs = 1; import "cb";`,
+		"cb.mk": `import "ca";`,
+	})
+
+	entry := filepath.Join(dir, "ca.mk")
+	importer := NewImporter()
+	leave := importer.Enter(entry)
+	program := parser.New(lexer.NewFile(entry, `let runs = 1; import "cb";`)).ParseProgram()
+	evaluated := EvalContext(WithImporter(context.Background(), importer), program, object.NewEnvironment(), Limits{})
+	leave()
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "import cycle: ca.mk -> cb.mk -> ca.mk" {
+		t.Errorf("wrong error. got=%q", errObj.Message)
+	}
+
+	if len(importer.loading) != 0 {
+		t.Errorf("script still marked as running. got=%q", importer.loading)
+	}
+}
+
+// Helper function to write files below a directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rielj/go-interpreter/object"
+)
+
+// DefaultMaxDepth is the call depth allowed when Limits.MaxDepth is zero.
+// Every call of a Monkey function takes several Go stack frames, so deeper
+// recursion would eventually overflow the Go stack and crash the process.
+const DefaultMaxDepth = 10000
+
+// Number of steps between two checks of the context
+const contextCheckInterval = 1024
+
+// Limits bounds the work an evaluation may do. A zero field means no limit,
+// except for MaxDepth, which then defaults to DefaultMaxDepth.
+type Limits struct {
+	MaxSteps  int   // number of nodes evaluated
+	MaxDepth  int   // number of nested function calls
+	MaxMemory int64 // approximate bytes of strings, arrays and hashes allocated
+}
+
+// evaluator holds the state of one evaluation: the context that can stop
+// it, the importer of its modules and how much of its limits it has used up
+type evaluator struct {
+	ctx       context.Context
+	importer  *Importer
+	limits    Limits
+	steps     int
+	depth     int
+	allocated int64
+}
+
+// Helper function to create an evaluator
+func newEvaluator(ctx context.Context, limits Limits) *evaluator {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	return &evaluator{ctx: ctx, importer: importerFrom(ctx), limits: limits}
+}
+
+// Helper function to count an evaluation step. It returns an error once
+// the evaluation has to stop.
+func (e *evaluator) step() *object.Error {
+	e.steps++
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return newLimitError(object.STEP_LIMIT_ERROR, "step limit exceeded: %d steps", e.limits.MaxSteps)
+	}
+
+	// Asking the context is slow compared to a step, so only do it now and then
+	if e.steps%contextCheckInterval == 0 {
+		return e.checkContext()
+	}
+	return nil
+}
+
+// Helper function to turn a done context into an error
+func (e *evaluator) checkContext() *object.Error {
+	switch e.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return newLimitError(object.TIMEOUT_ERROR, "execution timed out")
+	default:
+		return newLimitError(object.CANCELLED_ERROR, "execution cancelled")
+	}
+}
+
+// Helper function to enter a function call. It fails if the call would
+// nest too deeply.
+func (e *evaluator) enterCall() *object.Error {
+	if e.depth >= e.limits.MaxDepth {
+		return newLimitError(object.STACK_OVERFLOW_ERROR, "stack overflow")
+	}
+	e.depth++
+	return nil
+}
+
+// Helper function to leave a function call
+func (e *evaluator) leaveCall() {
+	e.depth--
+}
+
+// Helper function to create an error that stops a program for exceeding
+// its limits rather than for a mistake in it
+func newLimitError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"github.com/rielj/go-interpreter/object"
+)
+
+// Approximate sizes in bytes used for memory accounting. Every allocation
+// of a string, array or hash counts towards Limits.MaxMemory, even once the
+// value is no longer used, so the limit bounds the total work of a program
+// rather than what it holds on to at a time.
+const (
+	objectSize  = 32 // an object with its header
+	elementSize = 16 // an element of an array
+	pairSize    = 64 // a pair of a hash, with its key
+)
+
+// Helper function to account for an allocation. It returns an error once
+// the evaluation has allocated more than its limit.
+func (e *evaluator) allocate(size int64) *object.Error {
+	e.allocated += size
+	if e.limits.MaxMemory > 0 && e.allocated > e.limits.MaxMemory {
+		return newLimitError(object.MEMORY_LIMIT_ERROR, "memory limit exceeded: %d bytes", e.limits.MaxMemory)
+	}
+	return nil
+}
+
+// Helper function to evaluate infix expressions. Concatenated strings are
+// accounted for before they are built, so that a program doubling a string
+// is stopped before the string gets huge.
+func (e *evaluator) evalInfix(operator string, left, right object.Object) object.Object {
+	if operator == "+" {
+		l, lok := left.(*object.String)
+		r, rok := right.(*object.String)
+		if lok && rok {
+			if err := e.allocate(objectSize + int64(len(l.Value)+len(r.Value))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return evalInfixExpression(operator, left, right)
+}
+
+// Helper function to get the approximate size of a string, array or hash,
+// not including the values it contains, which are accounted for when they
+// are created
+func sizeOf(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.String:
+		return objectSize + int64(len(obj.Value))
+	case *object.Array:
+		return objectSize + elementSize*int64(len(obj.Elements))
+	case *object.Hash:
+		return objectSize + pairSize*int64(len(obj.Pairs))
+	default:
+		return 0
+	}
+}
+
+// Helper function to get the size an index assignment adds. Only a new
+// key of a hash takes more memory.
+func assignmentSize(left, index object.Object) int64 {
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return 0
+	}
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return 0
+	}
+	if _, ok := hash.Pairs[key.HashKey()]; ok {
+		return 0
+	}
+	return pairSize
+}
+
+// Helper function to check if a builtin returned a value it allocated,
+// rather than one of its arguments or an element of one
+func isAllocated(result object.Object, args []object.Object) bool {
+	for _, arg := range args {
+		if result == arg {
+			return false
+		}
+		if array, ok := arg.(*object.Array); ok {
+			for _, el := range array.Elements {
+				if result == el {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package evaluator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/parser"
+	"github.com/rielj/go-interpreter/token"
+)
+
+// ModuleExtension is added to import paths that have no extension
+const ModuleExtension = ".mk"
+
+// Importer loads the modules of import statements. Every module is
+// evaluated once per importer; later imports share the same module object.
+// An importer must not be used by several evaluations at the same time.
+type Importer struct {
+	// SearchPath lists the directories searched for modules that are not
+	// found next to the importing file
+	SearchPath []string
+
+	modules map[string]*object.Module // loaded modules by absolute path
+	loading []string                  // modules being evaluated, outermost first
+}
+
+// NewImporter returns an importer that searches the directories after the
+// directory of the importing file
+func NewImporter(searchPath ...string) *Importer {
+	return &Importer{SearchPath: searchPath, modules: make(map[string]*object.Module)}
+}
+
+// Enter marks the script at path as running until the returned function is
+// called, so that a module importing the script back is reported as an
+// import cycle instead of running the script a second time as a module
+func (imp *Importer) Enter(path string) (leave func()) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	imp.loading = append(imp.loading, path)
+	return func() { imp.loading = imp.loading[:len(imp.loading)-1] }
+}
+
+type importerKey struct{}
+
+// WithImporter returns a context that makes EvalContext load modules with
+// the importer. Without one, every evaluation starts with an empty cache
+// and no search path.
+func WithImporter(ctx context.Context, importer *Importer) context.Context {
+	return context.WithValue(ctx, importerKey{}, importer)
+}
+
+// Helper function to get the importer of a context
+func importerFrom(ctx context.Context) *Importer {
+	if importer, ok := ctx.Value(importerKey{}).(*Importer); ok {
+		return importer
+	}
+	return NewImporter()
+}
+
+// Helper function to evaluate an import statement, binding the module in
+// the environment
+func (e *evaluator) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	name := moduleName(node)
+	if !isIdentifier(name) {
+		return newError("cannot bind module %q to %q, rename it with as", node.Path.Value, name)
+	}
+
+	path, err := e.importer.resolve(node.Path.Value, node.Pos().Filename)
+	if err != nil {
+		return err
+	}
+
+	module, err := e.loadModule(path, node.Pos())
+	if err != nil {
+		return err
+	}
+
+	env.Set(name, module)
+	return nil
+}
+
+// Helper function to evaluate a module the first time it is imported. The
+// module is named after its file, since every import shares it whatever
+// name it is bound to.
+func (e *evaluator) loadModule(path string, importPos token.Position) (*object.Module, *object.Error) {
+	imp := e.importer
+	if module, ok := imp.modules[path]; ok {
+		return module, nil
+	}
+
+	// A module that is still being evaluated imports itself
+	for i, loading := range imp.loading {
+		if loading == path {
+			cycle := []string{}
+			for _, p := range imp.loading[i:] {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			cycle = append(cycle, filepath.Base(path))
+			return nil, newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	src, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, newError("cannot import %s: %s", path, readErr)
+	}
+
+	p := parser.New(lexer.NewFile(path, string(src)))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		return nil, newError("syntax error in module %s: %s", name, errs[0])
+	}
+
+	module := &object.Module{Name: name, Path: path, Env: object.NewEnvironment()}
+
+	// Pop the module even if its evaluation panics, so that importing it
+	// again later is not taken for a cycle
+	imp.loading = append(imp.loading, path)
+	defer func() { imp.loading = imp.loading[:len(imp.loading)-1] }()
+	evaluated := e.eval(program, module.Env)
+
+	// Failed modules are not cached, so importing them again retries
+	if err, ok := evaluated.(*object.Error); ok {
+		err.Stack = append(err.Stack, object.Frame{Function: "module " + name, CallSite: importPos})
+		return nil, err
+	}
+
+	imp.modules[path] = module
+	return module, nil
+}
+
+// Helper function to find the file of an import path. Relative paths are
+// looked up next to the importing file first, then in the search path.
+func (imp *Importer) resolve(path, importer string) (string, *object.Error) {
+	var dirs []string
+	if filepath.IsAbs(path) {
+		dirs = []string{""}
+	} else {
+		dirs = append([]string{filepath.Dir(importer)}, imp.SearchPath...)
+	}
+
+	for _, dir := range dirs {
+		candidates := []string{filepath.Join(dir, path)}
+		if filepath.Ext(path) == "" {
+			candidates = append(candidates, filepath.Join(dir, path+ModuleExtension))
+		}
+
+		for _, candidate := range candidates {
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				if abs, err := filepath.Abs(candidate); err == nil {
+					candidate = abs
+				}
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", newError("module not found: %q", path)
+}
+
+// Helper function to get the name an import statement binds: the alias,
+// or else the file name without its extension
+func moduleName(node *ast.ImportStatement) string {
+	if node.Alias != nil {
+		return node.Alias.Value
+	}
+	base := filepath.Base(node.Path.Value)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Helper function to check that a module name can be used as an identifier
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == name
+}
+
+// Helper function to evaluate member expressions
+func evalMemberExpression(left object.Object, member *ast.Identifier) object.Object {
+	module, ok := left.(*object.Module)
+	if !ok {
+		return newError("member access not supported: %s", left.Type())
+	}
+
+	val, ok := module.Env.Get(member.Value)
+	if !ok {
+		return newError("module %s has no member %s", module.Name, member.Value)
+	}
+	return val
+}
@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"unicode/utf8"
+
+	"github.com/rielj/go-interpreter/object"
+)
+
+// The functions in this file expose the semantics of the evaluator's
+// operators to the bytecode virtual machine, so that both engines agree on
+// every result and error message.
+
+// EvalPrefixOperator applies a prefix operator such as "-" or "!"
+func EvalPrefixOperator(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// EvalInfixOperator applies an infix operator such as "+" or "=="
+func EvalInfixOperator(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// EvalIndex evaluates left[index]
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// EvalIndexAssignment evaluates left[index] = val and returns val
+func EvalIndexAssignment(left, index, val object.Object) object.Object {
+	return evalIndexAssignment(left, index, val)
+}
+
+// Interpolate joins the values of an interpolated string
+func Interpolate(parts []object.Object) object.Object {
+	return interpolate(parts)
+}
+
+// IsTruthy reports whether a value counts as true in a condition
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// NewIterator returns a function that yields the elements of an iterable
+// one at a time, and false once there are no more. Arrays yield their
+// elements, hashes their sorted keys, strings their characters and ranges
+// their integers.
+func NewIterator(iterable object.Object) (func() (object.Object, bool), *object.Error) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements := iterable.Elements
+		i := 0
+		return func() (object.Object, bool) {
+			if i >= len(elements) {
+				return nil, false
+			}
+			i++
+			return elements[i-1], true
+		}, nil
+	case *object.Hash:
+		keys := iterable.Keys()
+		i := 0
+		return func() (object.Object, bool) {
+			if i >= len(keys) {
+				return nil, false
+			}
+			i++
+			return keys[i-1], true
+		}, nil
+	case *object.String:
+		s := iterable.Value
+		return func() (object.Object, bool) {
+			if s == "" {
+				return nil, false
+			}
+			ch, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+			return &object.String{Value: string(ch)}, true
+		}, nil
+	case *object.Range:
+		r := iterable
+		i, done := r.Start, false
+		return func() (object.Object, bool) {
+			if done || !inRange(r, i) {
+				return nil, false
+			}
+			value := i
+			// Stop once the next value would overflow instead of wrapping
+			// around to the other end of the range
+			next, ok := addInt64(i, r.Step)
+			i, done = next, !ok
+			return &object.Integer{Value: value}, true
+		}, nil
+	default:
+		return nil, newError("not iterable: %s", iterable.Type())
+	}
+}
@@ -0,0 +1,142 @@
+// Package interpreter embeds the Monkey programming language in Go
+// programs.
+//
+//	in := interpreter.New()
+//	in.RegisterFunc("greet", func(name string) string { return "hi " + name })
+//	result, err := in.Run(`greet("monkey")`)
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/parser"
+)
+
+// Interpreter runs Monkey programs. Globals defined by one run stay
+// visible to later runs and calls.
+type Interpreter struct {
+	// Limits bound every run and call. The zero value means no limits.
+	Limits evaluator.Limits
+
+	// Importer loads the modules imported by runs. Modules are shared by
+	// all runs, and are searched for in the directory of the current
+	// process before the search path of the importer.
+	Importer *evaluator.Importer
+
+	env *object.Environment
+}
+
+// SyntaxError is returned for programs that do not parse
+type SyntaxError struct {
+	Errors []*parser.ParseError
+}
+
+// Error returns the messages of all parse errors, one per line
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// New returns an interpreter without any globals
+func New() *Interpreter {
+	return &Interpreter{Importer: evaluator.NewImporter(), env: object.NewEnvironment()}
+}
+
+// Run evaluates a program and returns the value of its last statement.
+// Runtime errors are returned as *object.Error, with the position and
+// stack trace of the error.
+func (i *Interpreter) Run(src string) (object.Object, error) {
+	return i.RunContext(context.Background(), src)
+}
+
+// RunContext is like Run, but stops the program once ctx is done
+func (i *Interpreter) RunContext(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		return nil, &SyntaxError{Errors: errs}
+	}
+
+	ctx = evaluator.WithImporter(ctx, i.Importer)
+	return result(evaluator.EvalContext(ctx, program, i.env, i.Limits))
+}
+
+// Call calls the function bound to a global with the arguments, which
+// are converted to Monkey values first
+func (i *Interpreter) Call(name string, args ...interface{}) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is like Call, but stops the function once ctx is done
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (object.Object, error) {
+	fn, ok := i.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("identifier not found: %s", name)
+	}
+
+	objs := make([]object.Object, len(args))
+	for n, arg := range args {
+		obj, err := object.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s: %w", n+1, name, err)
+		}
+		objs[n] = obj
+	}
+
+	ctx = evaluator.WithImporter(ctx, i.Importer)
+	return result(evaluator.ApplyContext(ctx, fn, objs, i.Limits))
+}
+
+// SetGlobal binds a global to a Go value converted with object.FromGo.
+// Functions are wrapped as with RegisterFunc.
+func (i *Interpreter) SetGlobal(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+	if reflect.ValueOf(value).Kind() == reflect.Func {
+		obj, err = object.WrapFunc(name, value)
+	} else {
+		obj, err = object.FromGo(value)
+	}
+	if err != nil {
+		return fmt.Errorf("global %s: %w", name, err)
+	}
+
+	i.env.Set(name, obj)
+	return nil
+}
+
+// GetGlobal returns the value bound to a global
+func (i *Interpreter) GetGlobal(name string) (object.Object, bool) {
+	return i.env.Get(name)
+}
+
+// RegisterFunc makes a Go function callable from Monkey programs under
+// the name. Arguments and results are converted as by object.WrapFunc.
+// Parameters of type object.Object receive the Monkey values unchanged.
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	if v := reflect.ValueOf(fn); v.Kind() != reflect.Func {
+		return fmt.Errorf("RegisterFunc %s: not a function: %T", name, fn)
+	}
+	return i.SetGlobal(name, fn)
+}
+
+// Helper function to split the result of an evaluation into a value and
+// an error. Programs ending in a statement without a value return NULL.
+func result(obj object.Object) (object.Object, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+	if obj == nil {
+		return evaluator.NULL, nil
+	}
+	return obj, nil
+}
@@ -0,0 +1,217 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/object"
+)
+
+func TestRun(t *testing.T) {
+	in := New()
+
+	if _, err := in.Run("let add = fn(a, b) { a + b };"); err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	// Globals stay defined between runs
+	result, err := in.Run("add(1, 2)")
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if result.Inspect() != "3" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	result, err = in.Run("let x = 1;")
+	if err != nil || result != evaluator.NULL {
+		t.Errorf("let statement did not return NULL. got=%v, %v", result, err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Run("let = 5;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("no syntax error returned. got=%T(%v)", err, err)
+	}
+	if err.Error() != "1:5: expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong syntax error. got=%q", err)
+	}
+
+	_, err = in.Run("let f = fn() { 1 + true };\nf()")
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("no runtime error returned. got=%T(%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" || runtimeErr.Pos.String() != "1:16" {
+		t.Errorf("wrong runtime error. got=%q at %s", runtimeErr.Message, runtimeErr.Pos)
+	}
+
+	in.Limits = evaluator.Limits{MaxSteps: 100}
+	_, err = in.Run("while (true) {}")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.STEP_LIMIT_ERROR {
+		t.Errorf("step limit not applied. got=%v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+	if _, err := in.Run(`let greet = fn(name, times) { let s = ""; for (i in range(times)) { s += name } s };`); err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	result, err := in.Call("greet", "ab", 3)
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	if result.Inspect() != "ababab" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"missing", nil, "identifier not found: missing"},
+		{"greet", []interface{}{"ab"}, "wrong number of arguments. got=1, want=2"},
+		{"greet", []interface{}{"ab", make(chan int)}, "argument 2 to greet: cannot convert chan int to a Monkey value"},
+	}
+
+	for _, tt := range tests {
+		_, err := in.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestSetGlobal(t *testing.T) {
+	in := New()
+
+	globals := map[string]interface{}{
+		"count":  uint8(7),
+		"ratio":  float32(0.5),
+		"names":  []string{"a", "b"},
+		"config": map[string]int{"port": 80},
+		"big":    new(big.Int).Lsh(big.NewInt(1), 70),
+		"none":   (*int)(nil),
+		"flag":   true,
+	}
+	for name, value := range globals {
+		if err := in.SetGlobal(name, value); err != nil {
+			t.Fatalf("SetGlobal(%s) error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"count * 2", "14"},
+		{"ratio + 1", "1.5"},
+		{"names[1]", "b"},
+		{`config["port"]`, "80"},
+		{"big", "1180591620717411303424"},
+		{"none", "null"},
+		{"!flag", "false"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Run(tt.input)
+		if err != nil {
+			t.Errorf("%s: run error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. expected=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if err := in.SetGlobal("ch", make(chan int)); err == nil {
+		t.Errorf("no error for a channel")
+	}
+
+	in.Run("let answer = 42;")
+	answer, ok := in.GetGlobal("answer")
+	if !ok || answer.Inspect() != "42" {
+		t.Errorf("wrong global. got=%v, %t", answer, ok)
+	}
+	if _, ok := in.GetGlobal("nothing"); ok {
+		t.Errorf("undefined global found")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	in := New()
+
+	funcs := map[string]interface{}{
+		"upper": strings.ToUpper,
+		"sum": func(nums ...int) int {
+			total := 0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+		"keys": func(m map[string]interface{}) int { return len(m) },
+		"div": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("cannot divide %g by zero", a)
+			}
+			return a / b, nil
+		},
+		"typeOf":  func(obj object.Object) string { return string(obj.Type()) },
+		"nothing": func() {},
+		"small":   func(n int8) int8 { return n },
+		"echo":    func(v interface{}) interface{} { return v },
+	}
+	for name, fn := range funcs {
+		if err := in.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s) error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper("monkey")`, "MONKEY"},
+		{"sum()", "0"},
+		{"sum(1, 2, 3)", "6"},
+		{`keys({"a": 1, "b": [2]})`, "2"},
+		{"div(1, 4)", "0.25"},
+		{"typeOf(fn() {})", "FUNCTION"},
+		{"nothing()", "null"},
+		{`echo([1, "a", true, 1.5, nothing()])`, `[1, a, true, 1.5, null]`},
+		// Errors
+		{"div(1, 0)", "ERROR: cannot divide 1 by zero"},
+		{`upper(1)`, "ERROR: argument 1 to `upper` not supported, cannot convert INTEGER to string"},
+		{"small(1000)", "ERROR: argument 1 to `small` not supported, cannot convert INTEGER to int8"},
+		{`upper("a", "b")`, "ERROR: wrong number of arguments. got=2, want=1"},
+		{`sum(1, "2")`, "ERROR: argument 2 to `sum` not supported, cannot convert STRING to int"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Run(tt.input)
+		if err != nil {
+			result = err.(*object.Error)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. expected=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if err := in.RegisterFunc("notFunc", 5); err == nil {
+		t.Errorf("no error for registering a non-function")
+	}
+	if err := in.RegisterFunc("pair", func() (int, int) { return 1, 2 }); err == nil {
+		t.Errorf("no error for a function with two results")
+	}
+}
@@ -1,12 +1,34 @@
 package lexer
 
-import "github.com/rielj/go-interpreter/token"
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rielj/go-interpreter/token"
+)
 
 type Lexer struct {
-	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	r       io.Reader // source of the rest of the input, nil once used up
+	readErr error     // error that ended the input early
+	buf     []byte    // input from the start of the current token on
+	base    int       // offset of buf[0] in the input
+
+	filename     string // name of the file being lexed, used in positions
+	position     int    // current position in input (points to current char)
+	readPosition int    // current reading position in input (after current char)
+	ch           rune   // current char under examination
+	line         int    // line of the current char, starting at 1
+	column       int    // column of the current char, starting at 1, in bytes
+
+	// Number of unclosed braces in each interpolated expression being
+	// lexed, innermost last
+	interpolations []int
+
+	keepComments bool // return comments as tokens instead of skipping them
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -14,6 +36,23 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	// Skip comments like whitespace, unless they are kept
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		l.discard()
+		pos := l.pos()
+		tok = l.readComment()
+		if l.keepComments || tok.Type == token.ILLEGAL {
+			tok.Pos, tok.End = pos, l.pos()
+			return tok
+		}
+		l.skipWhitespace()
+	}
+
+	// Remember where the token starts. The input before it is not needed
+	// anymore.
+	l.discard()
+	pos := l.pos()
+
 	switch l.ch {
 	// Operators
 	case '=':
@@ -32,9 +71,9 @@ func (l *Lexer) NextToken() token.Token {
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newAssignToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newAssignToken(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		// Check if the next character is an equal sign
 		if l.peekChar() == '=' {
@@ -49,17 +88,48 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		if n := len(l.interpolations); n > 0 {
+			// The brace that closes an interpolated expression resumes the string
+			if l.interpolations[n-1] == 0 {
+				l.interpolations = l.interpolations[:n-1]
+				tok = l.readString(true)
+				tok.Pos, tok.End = pos, l.pos()
+				return tok
+			}
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.newAssignToken(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newAssignToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			tok = l.newPairToken('<', token.LT, token.SHIFT_LEFT)
+		} else {
+			tok = l.newPairToken('=', token.LT, token.LT_EQ)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			tok = l.newPairToken('>', token.GT, token.SHIFT_RIGHT)
+		} else {
+			tok = l.newPairToken('=', token.GT, token.GT_EQ)
+		}
+	case '&':
+		tok = l.newPairToken('&', token.AMPERSAND, token.AND)
+	case '|':
+		tok = l.newPairToken('|', token.PIPE, token.OR)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	// Delimiters
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
@@ -68,19 +138,38 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		// Read the string
-		tok.Literal = l.readString()
+		// Read the string, including the closing quote
+		tok = l.readString(false)
+		tok.Pos, tok.End = pos, l.pos()
+		return tok
+	case '`':
+		// Read the raw string, including the closing backtick
+		tok = l.readRawString()
+		tok.Pos, tok.End = pos, l.pos()
+		return tok
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		// A dot followed by a digit starts a number such as .5
+		if isDigit(l.peekChar()) {
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
+			return tok
+		}
+		tok = newToken(token.DOT, l.ch)
 	// End of file
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+		// Report a read error once, where the input ended
+		if l.readErr != nil && l.position-l.base >= len(l.buf) {
+			tok = token.Token{Type: token.ILLEGAL, Err: fmt.Sprintf("read error: %s", l.readErr)}
+			l.readErr = nil
+		}
 	default:
 		// If the character is a letter, we want to read the entire identifier
 		if isLetter(l.ch) {
@@ -88,12 +177,16 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readIdentifier()
 			// Check if the identifier is a keyword
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
 			// Read the number
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
+		} else if l.invalidChar() {
+			tok = l.illegalToken(l.position, "invalid UTF-8 encoding")
+			tok.Literal = l.text(l.position, l.readPosition)
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -101,19 +194,52 @@ func (l *Lexer) NextToken() token.Token {
 
 	// Read the next character
 	l.readChar()
+	tok.Pos, tok.End = pos, l.pos()
 	return tok
 }
 
+// pos returns the position of the current character
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// newAssignToken creates an operator token, or its compound assignment
+// variant if the operator is followed by an equal sign
+func (l *Lexer) newAssignToken(op, assign token.TokenType) token.Token {
+	return l.newPairToken('=', op, assign)
+}
+
+// newPairToken creates a token for the current character, or for the pair
+// of it and the next character if that is next
+func (l *Lexer) newPairToken(next rune, single, pair token.TokenType) token.Token {
+	if l.peekChar() == next {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: pair, Literal: string(ch) + string(l.ch)}
+	}
+	return newToken(single, l.ch)
+}
+
 // Peek at the next character
-func (l *Lexer) peekChar() byte {
-	// Check if the reading position is at the end of the input
-	if l.readPosition >= len(l.input) {
-		// ASCII code for "NUL"
+func (l *Lexer) peekChar() rune {
+	// At the end of the input this is NUL
+	r, _ := l.decodeAt(l.readPosition)
+	return r
+}
+
+// Peek at the byte n bytes after the current character's first byte. It is
+// only used to look ahead over ASCII characters.
+func (l *Lexer) peekCharAt(n int) rune {
+	l.fill(l.position + n + 1)
+	if l.position+n-l.base >= len(l.buf) {
 		return 0
-	} else {
-		// ASCII code for the character at the reading position
-		return l.input[l.readPosition]
 	}
+	return rune(l.buf[l.position+n-l.base])
 }
 
 // Skip the whitespace
@@ -124,46 +250,260 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-// Read the entire number
-func (l *Lexer) readNumber() string {
+// Read the entire number, which is a float if it has a fraction or an
+// exponent and an integer otherwise
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	// Save the current position
 	position := l.position
-	// Read the next character
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+
+	// Read an integer with a base prefix. Letters and digits that do not
+	// belong to the base are kept in the literal, so that the parser can
+	// report them.
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) || isLetter(l.ch) {
+			l.readChar()
+		}
+		return tokenType, l.text(position, l.position)
+	}
+
+	// Read the integer part
+	l.readDigits()
+
+	// Read the fraction
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
+	}
+
+	// Read the exponent, which needs at least one digit
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(l.peekCharAt(2)) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
 	}
+
 	// Return the number
-	return l.input[position:l.position]
+	return tokenType, l.text(position, l.position)
 }
 
-// Read the entire string
-func (l *Lexer) readString() string {
-	// Save the current position
-	position := l.position + 1
-	// Read the next character
+// Read a line comment up to the end of the line, or a block comment up to
+// its closing */. Block comments nest, so that code containing comments
+// can be commented out.
+func (l *Lexer) readComment() token.Token {
+	// Save the position of the first slash
+	position := l.position
+
+	// A line comment does not include the newline
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.text(position, l.position)}
+	}
+
+	depth := 0
 	for {
+		switch {
+		case l.ch == 0:
+			return l.illegalToken(position, "unterminated comment")
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return token.Token{Type: token.COMMENT, Literal: l.text(position, l.position)}
+			}
+		}
 		l.readChar()
-		// Check if the current character is a double quote or the end of the input
-		if l.ch == '"' || l.ch == 0 {
-			break
+	}
+}
+
+// Read a run of decimal digits and the underscores between them
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// Read the string up to the closing quote or the next interpolation, and
+// decode its escape sequences. The string continues after an interpolated
+// expression if continued is set. A string that is not closed on the same
+// line, or has a bad escape sequence, becomes an ILLEGAL token.
+func (l *Lexer) readString(continued bool) token.Token {
+	// Save the position of the opening quote or the closing brace
+	position := l.position
+	var out strings.Builder
+	var err string
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			l.readChar()
+			if err != "" {
+				return l.illegalToken(position, err)
+			}
+			if continued {
+				return token.Token{Type: token.STRING_TAIL, Literal: out.String()}
+			}
+			return token.Token{Type: token.STRING, Literal: out.String()}
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				break
+			}
+			// Lex the interpolated expression until its closing brace
+			l.readChar()
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			if err != "" {
+				return l.illegalToken(position, err)
+			}
+			if continued {
+				return token.Token{Type: token.STRING_MID, Literal: out.String()}
+			}
+			return token.Token{Type: token.STRING_HEAD, Literal: out.String()}
+		case '\n', 0:
+			return l.illegalToken(position, "unterminated string")
+		case '\\':
+			l.readChar()
+			if l.ch == '\n' || l.ch == 0 {
+				return l.illegalToken(position, "unterminated string")
+			}
+			// Keep reading after a bad escape to find the end of the string
+			if msg := l.readEscape(&out); msg != "" && err == "" {
+				err = msg
+			}
+		default:
+			if l.invalidChar() && err == "" {
+				err = "invalid UTF-8 encoding in string"
+			}
+			out.WriteRune(l.ch)
 		}
 	}
-	// Return the string
-	return l.input[position:l.position]
 }
 
+// Read the escape sequence after a backslash and write the character it
+// stands for. It returns a message if the escape sequence is invalid.
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case '$':
+		out.WriteByte('$')
+	case 'u':
+		// A code point of one to six hex digits in braces, as in \u{1F600}
+		if l.peekChar() != '{' {
+			return "invalid Unicode escape, expected \\u{...}"
+		}
+		l.readChar()
+		start := l.position + 1
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		digits := l.text(start, l.position+1)
+		if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+			return "invalid Unicode escape, expected \\u{...}"
+		}
+		l.readChar()
+
+		code, _ := strconv.ParseUint(digits, 16, 32)
+		r := rune(code)
+		if !utf8.ValidRune(r) {
+			return fmt.Sprintf("invalid Unicode code point U+%s", strings.ToUpper(digits))
+		}
+		out.WriteRune(r)
+	default:
+		return fmt.Sprintf("unknown escape sequence \\%c", l.ch)
+	}
+	return ""
+}
+
+// Read a raw string, which ends at the next backtick and may span lines.
+// Backslashes have no special meaning in it.
+func (l *Lexer) readRawString() token.Token {
+	// Save the position of the opening backtick
+	position := l.position
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '`':
+			l.readChar()
+			return token.Token{Type: token.STRING, Literal: l.text(position+1, l.position-1)}
+		case 0:
+			return l.illegalToken(position, "unterminated raw string")
+		case utf8.RuneError:
+			if l.invalidChar() {
+				// Skip to the closing backtick to resume after the string
+				for l.ch != '`' && l.ch != 0 {
+					l.readChar()
+				}
+				l.readChar()
+				return l.illegalToken(position, "invalid UTF-8 encoding in string")
+			}
+		}
+	}
+}
+
+// illegalToken creates an ILLEGAL token for the input read since position
+func (l *Lexer) illegalToken(position int, err string) token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: l.text(position, l.position), Err: err}
+}
+
+// Read the next character, decoding it from UTF-8
 func (l *Lexer) readChar() {
+	// Move to the next line after a newline
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	// Move past the bytes of the current character
+	l.column += l.readPosition - l.position
+
+	// Decode the character at the reading position. Invalid UTF-8 is
+	// read one byte at a time as utf8.RuneError.
+	r, size := l.decodeAt(l.readPosition)
+
 	// Check if the reading position is at the end of the input
-	if l.readPosition >= len(l.input) {
+	if size == 0 {
 		// ASCII code for "NUL"
 		l.ch = 0
-	} else {
-		// ASCII code for the character at the current position
-		l.ch = l.input[l.readPosition]
+		l.position = l.readPosition
+		l.readPosition += 1
+		return
 	}
-	// Increment the current position and reading position by 1
+
+	l.ch = r
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
+}
+
+// Check if the current character is a byte of invalid UTF-8, rather than
+// an encoded U+FFFD
+func (l *Lexer) invalidChar() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
 }
 
 // Read the entire identifier
@@ -175,29 +515,55 @@ func (l *Lexer) readIdentifier() string {
 		l.readChar()
 	}
 	// Return the identifier
-	return l.input[position:l.position]
+	return l.text(position, l.position)
+}
+
+// KeepComments makes the lexer return comments as COMMENT tokens, for tools
+// that need them. The parser does not accept COMMENT tokens.
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a lexer whose token positions refer to the given file name
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{buf: []byte(input), filename: filename, line: 1, column: 1}
 	// Read the first character
 	l.readChar()
 	return l
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
-	// Convert the byte to a string
+func newToken(tokenType token.TokenType, ch rune) token.Token {
+	// Convert the character to a string
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 // Check if the character is a letter
-func isLetter(ch byte) bool {
-	// Check if the character is a letter or an underscore
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	// Check if the character is a letter of any script or an underscore
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
 // Check if the character is a digit
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	// Check if the character is a digit
 	return '0' <= ch && ch <= '9'
 }
+
+// Check if the character follows a 0 to give the base of an integer
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// Check if the character is a hexadecimal digit
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/rielj/go-interpreter/token"
 )
@@ -17,7 +21,7 @@ func TestNextToken(t *testing.T) {
 		};
 
 		let result = add(five, ten);
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -35,6 +39,15 @@ func TestNextToken(t *testing.T) {
 		[1, 2];
 
 		{"foo": "bar"};
+
+		while for in break continue
+
+		+= -= *= /=
+
+		a <= b >= c % d && e || f & g
+		a | b ^ ~c << d >> e
+
+		import "lib" as l; l.name
 	`
 
 	tests := []struct {
@@ -89,7 +102,7 @@ func TestNextToken(t *testing.T) {
 		{token.RPAREN, ")"},
 		{token.SEMICOLON, ";"},
 
-		// !-/*5;
+		// !-/ *5;
 		{token.BANG, "!"},
 		{token.MINUS, "-"},
 		{token.SLASH, "/"},
@@ -165,6 +178,56 @@ func TestNextToken(t *testing.T) {
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
 
+		// while for in break continue
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+
+		// += -= *= /=
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+
+		// a <= b >= c % d && e || f & g
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "g"},
+
+		// a | b ^ ~c << d >> e
+		{token.IDENT, "a"},
+		{token.PIPE, "|"},
+		{token.IDENT, "b"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "c"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENT, "d"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "e"},
+
+		// import "lib" as l; l.name
+		{token.IMPORT, "import"},
+		{token.STRING, "lib"},
+		{token.AS, "as"},
+		{token.IDENT, "l"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "l"},
+		{token.DOT, "."},
+		{token.IDENT, "name"},
+
 		// End of file
 		{token.EOF, ""},
 	}
@@ -189,3 +252,373 @@ func TestNextToken(t *testing.T) {
 
 	// t.Logf("Tests passed\n input is [%s]\n", input)
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"hi\" == y"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedPos    token.Position
+		expectedEndCol int
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Offset: 0, Line: 1, Column: 1}, 4},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 4, Line: 1, Column: 5}, 6},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Offset: 6, Line: 1, Column: 7}, 8},
+		{token.INT, token.Position{Filename: "test.mk", Offset: 8, Line: 1, Column: 9}, 10},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}, 11},
+		{token.STRING, token.Position{Filename: "test.mk", Offset: 13, Line: 2, Column: 3}, 7},
+		{token.EQ, token.Position{Filename: "test.mk", Offset: 18, Line: 2, Column: 8}, 10},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}, 12},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12}, 13},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End.Column != tt.expectedEndCol {
+			t.Fatalf("tests[%d] - end column wrong. expected=%d, got=%d",
+				i, tt.expectedEndCol, tok.End.Column)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `3.14 1e-9 .5 2E+3 10 1.x 7e 4.5e2 0xFF 0o755 0B1010 1_000.5 0x 0b102 1__0`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "2E+3"},
+		{token.INT, "10"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.FLOAT, "4.5e2"},
+		{token.INT, "0xFF"},
+		{token.INT, "0o755"},
+		{token.INT, "0B1010"},
+		{token.FLOAT, "1_000.5"},
+		// Malformed literals are left for the parser to report
+		{token.INT, "0x"},
+		{token.INT, "0b102"},
+		{token.INT, "1__0"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"a\tb\n" "say \"hi\"" "back\\slash" "\u{48}\u{1F600}" ` + "`raw\\n\nline` \"\""
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\tb\n"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, "H\U0001F600"},
+		{token.STRING, "raw\\n\nline"},
+		{token.STRING, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%s)",
+				i, tt.expectedType, tok.Type, tok.Err)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIllegalStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedErr     string
+		expectedNext    token.TokenType
+	}{
+		{`"abc`, `"abc`, "unterminated string", token.EOF},
+		{"\"abc\nx", `"abc`, "unterminated string", token.IDENT},
+		{`"abc\`, `"abc\`, "unterminated string", token.EOF},
+		{"`abc\n", "`abc\n", "unterminated raw string", token.EOF},
+		{`"a\qb" x`, `"a\qb"`, `unknown escape sequence \q`, token.IDENT},
+		{`"\u{}"`, `"\u{}"`, `invalid Unicode escape, expected \u{...}`, token.EOF},
+		{`"\u41"`, `"\u41"`, `invalid Unicode escape, expected \u{...}`, token.EOF},
+		{`"\u{1234567}"`, `"\u{1234567}"`, `invalid Unicode escape, expected \u{...}`, token.EOF},
+		{`"\u{D800}"`, `"\u{D800}"`, "invalid Unicode code point U+D800", token.EOF},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%q: tokentype wrong. expected=ILLEGAL, got=%q", tt.input, tok.Type)
+			continue
+		}
+		if tok.Literal != tt.expectedLiteral || tok.Err != tt.expectedErr {
+			t.Errorf("%q: wrong token. expected=%q (%s), got=%q (%s)",
+				tt.input, tt.expectedLiteral, tt.expectedErr, tok.Literal, tok.Err)
+		}
+		// Lexing resumes after the broken string
+		if next := l.NextToken(); next.Type != tt.expectedNext {
+			t.Errorf("%q: next tokentype wrong. expected=%q, got=%q", tt.input, tt.expectedNext, next.Type)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "${y}"}["k"] } c" "$5 \${x}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "a "},
+		{token.IDENT, "x"},
+		{token.STRING_MID, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING_HEAD, ""},
+		{token.IDENT, "y"},
+		{token.STRING_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.STRING_TAIL, " c"},
+		{token.STRING, "$5 ${x}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 10 / 2; // trailing comment
+/* block /* nested */ still comment */ x /= 2;
+"// not a comment"
+/* unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		kept            bool // only returned when comments are kept
+	}{
+		{token.COMMENT, "// leading comment", true},
+		{token.LET, "let", false},
+		{token.IDENT, "x", false},
+		{token.ASSIGN, "=", false},
+		{token.INT, "10", false},
+		{token.SLASH, "/", false},
+		{token.INT, "2", false},
+		{token.SEMICOLON, ";", false},
+		{token.COMMENT, "// trailing comment", true},
+		{token.COMMENT, "/* block /* nested */ still comment */", true},
+		{token.IDENT, "x", false},
+		{token.SLASH_ASSIGN, "/=", false},
+		{token.INT, "2", false},
+		{token.SEMICOLON, ";", false},
+		{token.STRING, "// not a comment", false},
+		{token.ILLEGAL, "/* unterminated", false},
+		{token.EOF, "", false},
+	}
+
+	for _, keep := range []bool{false, true} {
+		l := New(input)
+		if keep {
+			l.KeepComments()
+		}
+
+		for i, tt := range tests {
+			if tt.kept && !keep {
+				continue
+			}
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("keep=%t tests[%d] - tokentype wrong. expected=%q, got=%q",
+					keep, i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("keep=%t tests[%d] - literal wrong. expected=%q, got=%q",
+					keep, i, tt.expectedLiteral, tok.Literal)
+			}
+
+			if tok.Type == token.ILLEGAL && tok.Err != "unterminated comment" {
+				t.Fatalf("keep=%t tests[%d] - wrong error. got=%q", keep, i, tok.Err)
+			}
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"👋 ${π}\"; λ\xffx \"a\xffb\" é"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 13},
+		{token.STRING_HEAD, "👋 ", 15},
+		{token.IDENT, "π", 23},
+		{token.STRING_TAIL, "", 25},
+		{token.SEMICOLON, ";", 27},
+		{token.IDENT, "λ", 29},
+		{token.ILLEGAL, "\xff", 31},
+		{token.IDENT, "x", 32},
+		{token.ILLEGAL, "\"a\xffb\"", 34},
+		{token.IDENT, "é", 40},
+		{token.EOF, "", 42},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+
+		if tok.Type == token.ILLEGAL && !strings.HasPrefix(tok.Err, "invalid UTF-8 encoding") {
+			t.Fatalf("tests[%d] - wrong error. got=%q", i, tok.Err)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	input := `let größe = "👋 ${name}"; /* a
+comment */ let long = "` + strings.Repeat("x", 3*readSize) + `";
+// the end
+3.5e2 == .5 ` + "`raw\nstring`"
+
+	readers := map[string]io.Reader{
+		"one byte":  iotest.OneByteReader(strings.NewReader(input)),
+		"half":      iotest.HalfReader(strings.NewReader(input)),
+		"data+eof":  iotest.DataErrReader(strings.NewReader(input)),
+		"in chunks": strings.NewReader(input),
+	}
+
+	for name, r := range readers {
+		expected := NewFile("test.mk", input)
+		l := NewFileReader("test.mk", r)
+		l.KeepComments()
+		expected.KeepComments()
+
+		for i := 0; ; i++ {
+			want, got := expected.NextToken(), l.NextToken()
+			if got != want {
+				t.Fatalf("%s: tokens[%d] wrong. expected=%+v, got=%+v", name, i, want, got)
+			}
+			if got.Type == token.EOF {
+				break
+			}
+		}
+	}
+
+	// Only the input of the current token is kept in memory
+	l := NewReader(strings.NewReader(strings.Repeat("let x = 1;\n", 100000)))
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if cap(l.buf) > 4*readSize {
+			t.Fatalf("buffer grew to %d bytes", cap(l.buf))
+		}
+	}
+}
+
+func TestNewReaderError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("disk on fire")))
+	l := NewReader(r)
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedErr  string
+	}{
+		{token.LET, ""},
+		{token.IDENT, ""},
+		{token.ILLEGAL, "read error: disk on fire"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Err != tt.expectedErr {
+			t.Fatalf("tests[%d] - wrong token. expected=%q (%s), got=%q (%s)",
+				i, tt.expectedType, tt.expectedErr, tok.Type, tok.Err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package lexer
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// Number of bytes read from a reader at a time
+const readSize = 4096
+
+// NewReader creates a lexer that reads its input from r as tokens are
+// requested, so that the whole program never has to be in memory. A read
+// error ends the input with an ILLEGAL token describing the error.
+func NewReader(r io.Reader) *Lexer {
+	return NewFileReader("", r)
+}
+
+// NewFileReader is like NewReader, with token positions that refer to the
+// given file name
+func NewFileReader(filename string, r io.Reader) *Lexer {
+	l := &Lexer{r: r, filename: filename, line: 1, column: 1}
+	// Read the first character
+	l.readChar()
+	return l
+}
+
+// Helper function to read from the reader until the buffer holds the input
+// up to offset end, or the input is used up
+func (l *Lexer) fill(end int) {
+	for l.r != nil && l.base+len(l.buf) < end {
+		// Make room for another read
+		if cap(l.buf)-len(l.buf) < readSize {
+			buf := make([]byte, len(l.buf), 2*cap(l.buf)+readSize)
+			copy(buf, l.buf)
+			l.buf = buf
+		}
+
+		n, err := l.r.Read(l.buf[len(l.buf) : len(l.buf)+readSize])
+		l.buf = l.buf[:len(l.buf)+n]
+		if err != nil {
+			if err != io.EOF {
+				l.readErr = err
+			}
+			l.r = nil
+		}
+	}
+}
+
+// Helper function to decode the character at an offset of the input. It
+// returns a size of 0 at the end of the input.
+func (l *Lexer) decodeAt(offset int) (rune, int) {
+	l.fill(offset + utf8.UTFMax)
+	if offset-l.base >= len(l.buf) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(l.buf[offset-l.base:])
+}
+
+// Helper function to get the input between two offsets, which must not
+// come before the start of the current token
+func (l *Lexer) text(start, end int) string {
+	if end-l.base > len(l.buf) {
+		end = l.base + len(l.buf)
+	}
+	return string(l.buf[start-l.base : end-l.base])
+}
+
+// Helper function to drop the input before the current character, once no
+// token needs it anymore
+func (l *Lexer) discard() {
+	if n := l.position - l.base; n > 0 && n <= len(l.buf) {
+		l.buf = l.buf[n:]
+		l.base = l.position
+	}
+}
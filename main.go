@@ -1,24 +1,214 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/compiler"
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/parser"
 	"github.com/rielj/go-interpreter/repl"
+	"github.com/rielj/go-interpreter/vm"
 )
 
+const usage = `Usage:
+  monkey                 start the interactive REPL
+  monkey FILE            run a Monkey script
+  monkey -e PROGRAM      run a program given on the command line
+  monkey < FILE          run a program read from stdin
+  monkey build FILE [-o OUT]
+                         compile a script to bytecode, by default FILE.mkc
+  monkey disasm FILE     print the bytecode of a script or compiled program
+
+Imported modules are looked up next to the importing file, then in the
+directories of the path flag, which defaults to $MONKEYPATH. Modules
+are only supported by the eval engine.
+
+The engine flag selects the tree-walking evaluator or the bytecode
+compiler and virtual machine for all of these. Compiled programs always
+run on the virtual machine.
+
+Flags:
+`
+
 func main() {
-	// Get the current user
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	expr := flag.String("e", "", "run `program` instead of a file")
+	engine := flag.String("engine", "eval", "run programs with the tree-walking `engine` \"eval\" or the bytecode \"vm\"")
+	path := flag.String("path", os.Getenv("MONKEYPATH"), "search the `directories` for imported modules, separated like $PATH")
+	flag.Parse()
+
+	searchPath = filepath.SplitList(*path)
+
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(os.Stderr, "monkey: unknown engine %q\n", *engine)
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "build":
+		os.Exit(build(flag.Args()[1:], os.Stderr))
+	case "disasm":
+		os.Exit(disasm(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
+	switch {
+	// Run the program given with -e
+	case *expr != "":
+		if flag.NArg() != 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(run(*engine, "-e", strings.NewReader(*expr), os.Stderr))
+	// Run a script file
+	case flag.NArg() == 1:
+		filename := flag.Arg(0)
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+			os.Exit(1)
+		}
+		status := run(*engine, filename, f, os.Stderr)
+		f.Close()
+		os.Exit(status)
+	case flag.NArg() > 1:
+		flag.Usage()
+		os.Exit(2)
+	// Run a program piped into stdin
+	case !isTerminal(os.Stdin):
+		os.Exit(run(*engine, "<stdin>", os.Stdin, os.Stderr))
 	}
 
 	// Print a welcome message
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Printf("Hello %s! This is the Monkey programming language!\n", name)
 	fmt.Printf("Feel free to type in commands\n")
 
 	// Start the REPL
+	repl.Engine = *engine
+	repl.SearchPath = searchPath
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// searchPath lists the directories searched for imported modules
+var searchPath []string
+
+// run parses and runs a whole program with the engine, reporting errors to
+// stderr. Compiled programs are run on the virtual machine. It returns the
+// process exit status.
+func run(engine, filename string, r io.Reader, stderr io.Writer) int {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(len(compiler.Magic))
+
+	// The compiler needs the whole program, while the evaluator's parser
+	// reads it as it goes
+	if engine == "vm" || compiler.IsBytecode(header) {
+		src, err := io.ReadAll(br)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 1
+		}
+		bytecode, ok := compile(filename, string(src), stderr)
+		if !ok {
+			return 1
+		}
+		if err := vm.New(bytecode).Run(); err != nil {
+			return reportError(err.(*object.Error), stderr)
+		}
+		return 0
+	}
+
+	program, ok := parse(lexer.NewFileReader(filename, br), stderr)
+	if !ok {
+		return 1
+	}
+
+	importer := evaluator.NewImporter(searchPath...)
+	if filename != "-e" && filename != "<stdin>" {
+		defer importer.Enter(filename)()
+	}
+
+	env := object.NewEnvironment()
+	ctx := evaluator.WithImporter(context.Background(), importer)
+	evaluated := evaluator.EvalContext(ctx, program, env, evaluator.Limits{})
+
+	// Report runtime errors with their stack trace
+	if err, ok := evaluated.(*object.Error); ok {
+		return reportError(err, stderr)
+	}
+
+	return 0
+}
+
+// parse parses a program, printing its errors to stderr
+func parse(l *lexer.Lexer, stderr io.Writer) (*ast.Program, bool) {
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(stderr, msg)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
+
+// compile compiles a program to bytecode, or loads it if src already is a
+// compiled program. Errors are printed to stderr.
+func compile(filename, src string, stderr io.Writer) (*compiler.Bytecode, bool) {
+	if compiler.IsBytecode([]byte(src)) {
+		bytecode, err := compiler.ReadBytecode(strings.NewReader(src))
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s: %s\n", filename, err)
+			return nil, false
+		}
+		return bytecode, true
+	}
+
+	program, ok := parse(lexer.NewFile(filename, src), stderr)
+	if !ok {
+		return nil, false
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "compilation failed: %s\n", err)
+		return nil, false
+	}
+
+	return comp.Bytecode(), true
+}
+
+// reportError prints a runtime error with its stack trace
+func reportError(err *object.Error, stderr io.Writer) int {
+	fmt.Fprintln(stderr, err.Inspect())
+	io.WriteString(stderr, err.StackTrace())
+	return 1
+}
+
+// isTerminal reports whether the file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
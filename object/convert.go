@@ -0,0 +1,548 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// FromGo converts a Go value to a Monkey value. Booleans, numbers and
+// strings become the matching objects, slices and arrays become Arrays,
+// maps become Hashes, and structs become Hashes keyed by field name. A
+// field tagged `monkey:"name"` is stored under that name instead, and one
+// tagged `monkey:"-"` is left out. Times become strings in RFC 3339
+// format, nil pointers, slices and maps become NULL, and functions become
+// builtins as with WrapFunc. Objects are returned unchanged.
+//
+// Values that contain themselves cannot be converted.
+func FromGo(v interface{}) (Object, error) {
+	c := &converter{visiting: map[visit]bool{}}
+	return c.fromGo(reflect.ValueOf(v))
+}
+
+// ToGo converts a Monkey value to its natural Go value: an int64,
+// *big.Int, float64, string, bool, nil, []interface{} or a map. Hashes
+// whose keys are all strings become map[string]interface{}, others
+// map[interface{}]interface{}. Functions are returned unchanged.
+func ToGo(obj Object) (interface{}, error) {
+	v, err := ToGoType(obj, reflect.TypeOf((*interface{})(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// ToGoType converts a Monkey value to a Go value of type t. It reverses
+// FromGo, so for example a Hash converts to a struct, reading the fields
+// from the keys FromGo would have written them to. Keys without a field
+// are ignored.
+func ToGoType(obj Object, t reflect.Type) (reflect.Value, error) {
+	c := &converter{visiting: map[visit]bool{}}
+	return c.toGo(obj, t)
+}
+
+// WrapFunc turns a Go function into a builtin. Arguments are converted to
+// the types of the parameters with ToGoType, and results back with
+// FromGo. The function may return one value, no value, or a value and an
+// error. A non-nil error becomes a runtime error. The name is used in
+// error messages.
+func WrapFunc(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("not a function: %T", fn)
+	}
+	return wrapFunc(name, v)
+}
+
+// visit is a Go value or Monkey object that is being converted
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	obj Object
+}
+
+// converter converts between Go and Monkey values, keeping track of the
+// values it is inside of to detect cycles
+type converter struct {
+	visiting map[visit]bool
+}
+
+// Helper function to enter a value that may contain itself
+func (c *converter) enter(key visit, what string) error {
+	if c.visiting[key] {
+		return fmt.Errorf("cannot convert cyclic %s", what)
+	}
+	c.visiting[key] = true
+	return nil
+}
+
+// Helper function to leave a value entered with enter
+func (c *converter) leave(key visit) {
+	delete(c.visiting, key)
+}
+
+// Helper function to convert a Go value to a Monkey value
+func (c *converter) fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+	if v.CanInterface() {
+		if obj, ok := v.Interface().(Object); ok {
+			return obj, nil
+		}
+	}
+
+	switch v.Type() {
+	case bigIntType:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromBigInt(v.Interface().(*big.Int)), nil
+	case timeType:
+		return &String{Value: v.Interface().(time.Time).Format(time.RFC3339Nano)}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return fromBigInt(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if err := c.enter(key, v.Type().String()); err != nil {
+			return nil, err
+		}
+		defer c.leave(key)
+		return c.fromGoArray(v)
+	case reflect.Array:
+		return c.fromGoArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if err := c.enter(key, v.Type().String()); err != nil {
+			return nil, err
+		}
+		defer c.leave(key)
+		return c.fromGoMap(v)
+	case reflect.Struct:
+		return c.fromGoStruct(v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if err := c.enter(key, v.Type().String()); err != nil {
+			return nil, err
+		}
+		defer c.leave(key)
+		return c.fromGo(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return c.fromGo(v.Elem())
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return wrapFunc("function", v)
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Monkey value", v.Type())
+	}
+}
+
+// Helper function to convert a Go slice or array to an Array
+func (c *converter) fromGoArray(v reflect.Value) (Object, error) {
+	elements := make([]Object, v.Len())
+	for i := range elements {
+		el, err := c.fromGo(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = el
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// Helper function to convert a Go map to a Hash
+func (c *converter) fromGoMap(v reflect.Value) (Object, error) {
+	hash := &Hash{Pairs: make(map[HashKey]HashPair, v.Len())}
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := c.fromGo(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.fromGo(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if err := setPair(hash, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return hash, nil
+}
+
+// Helper function to convert a Go struct to a Hash keyed by field name
+func (c *converter) fromGoStruct(v reflect.Value) (Object, error) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, field := range structFields(v.Type()) {
+		value, err := c.fromGo(v.FieldByIndex(field.index))
+		if err != nil {
+			return nil, err
+		}
+		setPair(hash, &String{Value: field.name}, value)
+	}
+	return hash, nil
+}
+
+// Helper function to add a pair to a hash
+func setPair(hash *Hash, key, value Object) error {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", key.Type())
+	}
+	hash.Pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+	return nil
+}
+
+// Helper function to convert a big integer, keeping small ones Integers
+func fromBigInt(i *big.Int) Object {
+	if i.IsInt64() {
+		return &Integer{Value: i.Int64()}
+	}
+	return &BigInt{Value: new(big.Int).Set(i)}
+}
+
+// Helper function to convert a Monkey value to a Go value of type t
+func (c *converter) toGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType || reflect.TypeOf(obj) == t {
+		return reflect.ValueOf(obj), nil
+	}
+
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+	}
+
+	if obj == NULL {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return fail()
+	}
+
+	switch t {
+	case bigIntType:
+		switch i := obj.(type) {
+		case *Integer:
+			return reflect.ValueOf(big.NewInt(i.Value)), nil
+		case *BigInt:
+			return reflect.ValueOf(new(big.Int).Set(i.Value)), nil
+		}
+		return fail()
+	case timeType:
+		s, ok := obj.(*String)
+		if !ok {
+			return fail()
+		}
+		tm, err := time.Parse(time.RFC3339Nano, s.Value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to a time", s.Value)
+		}
+		return reflect.ValueOf(tm), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		v, err := c.toGo(obj, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	case reflect.Interface:
+		natural := naturalType(obj)
+		if !natural.Implements(t) {
+			return fail()
+		}
+		v, err := c.toGo(obj, natural)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		// Keep the interface type, so that the value can be stored in
+		// containers of that type
+		iface := reflect.New(t).Elem()
+		iface.Set(v)
+		return iface, nil
+	}
+
+	// Arrays and hashes can contain themselves
+	switch obj.(type) {
+	case *Array, *Hash:
+		key := visit{obj: obj}
+		if err := c.enter(key, strings.ToLower(string(obj.Type()))); err != nil {
+			return reflect.Value{}, err
+		}
+		defer c.leave(key)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return fail()
+		}
+		return reflect.ValueOf(b.Value).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok || reflect.Zero(t).OverflowInt(i.Value) {
+			return fail()
+		}
+		return reflect.ValueOf(i.Value).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch i := obj.(type) {
+		case *Integer:
+			if i.Value < 0 {
+				return fail()
+			}
+			u = uint64(i.Value)
+		case *BigInt:
+			if !i.Value.IsUint64() {
+				return fail()
+			}
+			u = i.Value.Uint64()
+		default:
+			return fail()
+		}
+		if reflect.Zero(t).OverflowUint(u) {
+			return fail()
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *Float:
+			return reflect.ValueOf(n.Value).Convert(t), nil
+		case *Integer:
+			return reflect.ValueOf(float64(n.Value)).Convert(t), nil
+		}
+		return fail()
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return fail()
+		}
+		return reflect.ValueOf(s.Value).Convert(t), nil
+	case reflect.Slice, reflect.Array:
+		array, ok := obj.(*Array)
+		if !ok {
+			return fail()
+		}
+		var v reflect.Value
+		if t.Kind() == reflect.Slice {
+			v = reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+		} else if len(array.Elements) == t.Len() {
+			v = reflect.New(t).Elem()
+		} else {
+			return reflect.Value{}, fmt.Errorf("cannot convert ARRAY of length %d to %s", len(array.Elements), t)
+		}
+		for i, el := range array.Elements {
+			elem, err := c.toGo(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(elem)
+		}
+		return v, nil
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return fail()
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			k, err := c.toGo(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := c.toGo(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(k, v)
+		}
+		return m, nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return fail()
+		}
+		v := reflect.New(t).Elem()
+		for _, field := range structFields(t) {
+			pair, ok := hash.Pairs[(&String{Value: field.name}).HashKey()]
+			if !ok {
+				continue
+			}
+			value, err := c.toGo(pair.Value, field.typ)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			v.FieldByIndex(field.index).Set(value)
+		}
+		return v, nil
+	default:
+		return fail()
+	}
+}
+
+// Helper function to get the Go type a Monkey value naturally converts to
+func naturalType(obj Object) reflect.Type {
+	switch obj := obj.(type) {
+	case *Integer:
+		return reflect.TypeOf(int64(0))
+	case *BigInt:
+		return bigIntType
+	case *Float:
+		return reflect.TypeOf(float64(0))
+	case *String:
+		return reflect.TypeOf("")
+	case *Boolean:
+		return reflect.TypeOf(false)
+	case *Array:
+		return reflect.TypeOf([]interface{}{})
+	case *Hash:
+		// Hashes with only string keys become the usual Go maps
+		for _, pair := range obj.Pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				return reflect.TypeOf(map[interface{}]interface{}{})
+			}
+		}
+		return reflect.TypeOf(map[string]interface{}{})
+	default:
+		return reflect.TypeOf(obj)
+	}
+}
+
+// field is an exported field of a struct with the key it is stored under
+type field struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// Helper function to list the exported fields of a struct type. Fields
+// of embedded structs count as fields of the outer struct.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("monkey")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !tagged {
+			for _, inner := range structFields(f.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		fields = append(fields, field{name: name, index: []int{i}, typ: f.Type})
+	}
+	return fields
+}
+
+// Helper function to wrap a Go function as a builtin
+func wrapFunc(name string, fn reflect.Value) (*Builtin, error) {
+	t := fn.Type()
+	numOut := t.NumOut()
+	returnsError := numOut > 0 && t.Out(numOut-1) == errorType
+	if numOut > 2 || (numOut == 2 && !returnsError) {
+		return nil, fmt.Errorf("cannot convert %s to a Monkey value: too many results", t)
+	}
+
+	builtin := func(args ...Object) Object {
+		numIn := t.NumIn()
+		if t.IsVariadic() {
+			if len(args) < numIn-1 {
+				return newError("wrong number of arguments. got=%d, want at least %d", len(args), numIn-1)
+			}
+		} else if len(args) != numIn {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), numIn)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			v, err := ToGoType(arg, paramType(t, i))
+			if err != nil {
+				return newError("argument %d to `%s` not supported, %s", i+1, name, err)
+			}
+			in[i] = v
+		}
+
+		out := fn.Call(in)
+		if returnsError {
+			if err := out[numOut-1]; !err.IsNil() {
+				return newError("%s", err.Interface().(error))
+			}
+			out = out[:numOut-1]
+		}
+		if len(out) == 0 {
+			return NULL
+		}
+		obj, err := FromGo(out[0].Interface())
+		if err != nil {
+			return newError("result of `%s` not supported, %s", name, err)
+		}
+		return obj
+	}
+
+	return &Builtin{Fn: builtin}, nil
+}
+
+// Helper function to get the type of the i-th argument of a function
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	return t.In(i)
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
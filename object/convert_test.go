@@ -0,0 +1,229 @@
+package object
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Address struct {
+	City string `monkey:"city"`
+	Zip  int    `monkey:"zip"`
+}
+
+type Meta struct {
+	Version int
+}
+
+type Config struct {
+	Meta
+	Name     string            `monkey:"name"`
+	Ports    []int             `monkey:"ports"`
+	Labels   map[string]string `monkey:"labels"`
+	Address  *Address          `monkey:"address"`
+	Started  time.Time         `monkey:"started"`
+	Ratio    float64           `monkey:"ratio"`
+	Enabled  bool              `monkey:"enabled"`
+	Secret   string            `monkey:"-"`
+	internal int
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-5), "-5"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{2.5, "2.5"},
+		{"monkey", "monkey"},
+		{[]interface{}{1, "a", []int{2}}, "[1, a, [2]]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{(*int)(nil), "null"},
+		{[]int(nil), "null"},
+		{big.NewInt(7), "7"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02T03:04:05Z"},
+		{&Address{City: "Manila"}, "{city: Manila, zip: 0}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) error: %s", tt.input, err)
+			continue
+		}
+		// Hash pairs print in map order, so compare sorted
+		if got, want := sortedInspect(obj), sortedInspect(&String{Value: tt.expected}); got != want {
+			t.Errorf("FromGo(%#v) wrong. expected=%s, got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("booleans are not singletons")
+	}
+}
+
+func TestFromGoStruct(t *testing.T) {
+	obj, err := FromGo(Config{Meta: Meta{Version: 2}, Name: "app", Secret: "hidden", internal: 1})
+	if err != nil {
+		t.Fatalf("FromGo error: %s", err)
+	}
+	hash, ok := obj.(*Hash)
+	if !ok {
+		t.Fatalf("not a hash. got=%T", obj)
+	}
+
+	var keys []string
+	for _, key := range hash.Keys() {
+		keys = append(keys, key.Inspect())
+	}
+	expected := "Version address enabled labels name ports ratio started"
+	if strings.Join(keys, " ") != expected {
+		t.Errorf("wrong keys. expected=%q, got=%q", expected, strings.Join(keys, " "))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	config := Config{
+		Meta:    Meta{Version: 3},
+		Name:    "server",
+		Ports:   []int{80, 443},
+		Labels:  map[string]string{"env": "prod"},
+		Address: &Address{City: "Cebu", Zip: 6000},
+		Started: time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		Ratio:   0.75,
+		Enabled: true,
+	}
+
+	obj, err := FromGo(config)
+	if err != nil {
+		t.Fatalf("FromGo error: %s", err)
+	}
+	v, err := ToGoType(obj, reflect.TypeOf(Config{}))
+	if err != nil {
+		t.Fatalf("ToGoType error: %s", err)
+	}
+	if got := v.Interface().(Config); !reflect.DeepEqual(got, config) {
+		t.Errorf("wrong struct after round trip.\nwant=%+v\ngot= %+v", config, got)
+	}
+
+	value := map[string]interface{}{
+		"name":  "x",
+		"count": int64(3),
+		"big":   new(big.Int).Lsh(big.NewInt(1), 80),
+		"list":  []interface{}{1.5, true, nil, "s"},
+		"inner": map[string]interface{}{"ok": false},
+		"keys":  map[interface{}]interface{}{int64(1): "one", true: "yes"},
+	}
+
+	obj, err = FromGo(value)
+	if err != nil {
+		t.Fatalf("FromGo error: %s", err)
+	}
+	back, err := ToGo(obj)
+	if err != nil {
+		t.Fatalf("ToGo error: %s", err)
+	}
+	if !reflect.DeepEqual(back, value) {
+		t.Errorf("wrong value after round trip.\nwant=%#v\ngot= %#v", value, back)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	cyclic := &Array{}
+	cyclic.Elements = []Object{&Integer{Value: 1}, cyclic}
+
+	shared := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	tests := []struct {
+		obj      Object
+		typ      interface{}
+		expected string
+	}{
+		{&String{Value: "a"}, 0, "cannot convert STRING to int"},
+		{&Integer{Value: 300}, uint8(0), "cannot convert INTEGER to uint8"},
+		{&Integer{Value: -1}, uint(0), "cannot convert INTEGER to uint"},
+		{&Array{Elements: []Object{TRUE}}, []string{}, "cannot convert BOOLEAN to string"},
+		{&Array{Elements: []Object{TRUE}}, [2]bool{}, "cannot convert ARRAY of length 1 to [2]bool"},
+		{&String{Value: "yesterday"}, time.Time{}, `cannot convert "yesterday" to a time`},
+		{&Hash{Pairs: map[HashKey]HashPair{
+			(&String{Value: "zip"}).HashKey(): {Key: &String{Value: "zip"}, Value: &String{Value: "?"}},
+		}}, Address{}, "field zip: cannot convert STRING to int"},
+		{cyclic, []interface{}{}, "cannot convert cyclic array"},
+		// Shared values are not cycles
+		{&Array{Elements: []Object{shared, shared}}, [][]int{}, ""},
+	}
+
+	for _, tt := range tests {
+		_, err := ToGoType(tt.obj, reflect.TypeOf(tt.typ))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	loop := &node{}
+	loop.Next = loop
+
+	m := map[string]interface{}{}
+	m["self"] = m
+
+	s := []interface{}{nil}
+	s[0] = s
+
+	shared := &Address{}
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{make(chan int), "cannot convert chan int to a Monkey value"},
+		{map[interface{}]int{1.5: 1}, "unusable as hash key: FLOAT"},
+		{loop, "cannot convert cyclic *object.node"},
+		{m, "cannot convert cyclic map[string]interface {}"},
+		{s, "cannot convert cyclic []interface {}"},
+		{func() (int, int) { return 1, 2 }, "cannot convert func() (int, int) to a Monkey value: too many results"},
+		// Shared values are not cycles
+		{[]*Address{shared, shared}, ""},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// Helper function to inspect an object with the pairs of hashes sorted
+func sortedInspect(obj Object) string {
+	s := obj.Inspect()
+	if _, ok := obj.(*Hash); !ok && !strings.HasPrefix(s, "{") {
+		return s
+	}
+	inner := strings.Split(strings.Trim(s, "{}"), ", ")
+	sort.Strings(inner)
+	return "{" + strings.Join(inner, ", ") + "}"
+}
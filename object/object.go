@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/token"
 )
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BIGINT_OBJ       = "BIGINT"
 	BOOL_OBJ         = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -20,6 +27,12 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	RANGE_OBJ        = "RANGE"
+	MODULE_OBJ       = "MODULE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type ObjectType string
@@ -29,6 +42,14 @@ type Object interface {
 	Inspect() string
 }
 
+var (
+	// The booleans and null are singletons, so that they can be compared by
+	// pointer
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 // Integer
 type Integer struct {
 	Value int64
@@ -42,6 +63,37 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+// BigInt is an integer that does not fit in an Integer
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+func (b *BigInt) Type() ObjectType {
+	return BIGINT_OBJ
+}
+
+// Float
+type Float struct {
+	Value float64
+}
+
+// Inspect formats the float so that it never reads as an integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eInN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 // Boolean
 type Boolean struct {
 	Value bool
@@ -79,21 +131,102 @@ func (rv *ReturnValue) Type() ObjectType {
 	return RETURN_VALUE_OBJ
 }
 
+// Break is the signal produced by a break statement
+type Break struct{}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+// Continue is the signal produced by a continue statement
+type Continue struct{}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
 // Error
 type Error struct {
 	Message string
+	Kind    ErrorKind      // empty for errors in the program itself
+	Pos     token.Position // position of the node that failed
+	Stack   []Frame        // active function calls, innermost first
+}
+
+// ErrorKind tells apart the errors of programs that were stopped because
+// they ran out of time or resources
+type ErrorKind string
+
+const (
+	TIMEOUT_ERROR        ErrorKind = "TIMEOUT"
+	CANCELLED_ERROR      ErrorKind = "CANCELLED"
+	STEP_LIMIT_ERROR     ErrorKind = "STEP_LIMIT"
+	STACK_OVERFLOW_ERROR ErrorKind = "STACK_OVERFLOW"
+	MEMORY_LIMIT_ERROR   ErrorKind = "MEMORY_LIMIT"
+)
+
+// Number of calls shown at either end of a long stack trace
+const stackTraceEdge = 10
+
+// Frame is a function call that was active when an error occurred
+type Frame struct {
+	Function string         // name the function was bound to, if known
+	CallSite token.Position // where the function was called
 }
 
 func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
+// StackTrace returns the position of the error followed by one line per
+// active function call, innermost first. Only the ends of very deep stacks
+// are shown.
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	if e.Pos.IsValid() {
+		out.WriteString("    at " + e.Pos.String() + "\n")
+	}
+
+	for i, frame := range e.Stack {
+		// Leave out the middle of deep recursions
+		if len(e.Stack) > 2*stackTraceEdge && i >= stackTraceEdge && i < len(e.Stack)-stackTraceEdge {
+			if i == stackTraceEdge {
+				out.WriteString(fmt.Sprintf("    ... %d more calls\n", len(e.Stack)-2*stackTraceEdge))
+			}
+			continue
+		}
+
+		name := frame.Function
+		if name == "" {
+			name = "<anonymous>"
+		}
+		out.WriteString(fmt.Sprintf("    in %s called at %s\n", name, frame.CallSite))
+	}
+
+	return out.String()
+}
+
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 
+// Error makes runtime errors usable as Go errors
+func (e *Error) Error() string {
+	return e.Message
+}
+
 // Function
 type Function struct {
+	Name       string // name of the first binding, used in stack traces
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -123,6 +256,41 @@ func (f *Function) Type() ObjectType {
 	return FUNCTION_OBJ
 }
 
+// CompiledFunction is the bytecode of a function literal. It lives in the
+// constant pool and is turned into a Closure when the literal is evaluated.
+type CompiledFunction struct {
+	Name          string // name of the first binding, used in stack traces
+	Instructions  code.Instructions
+	Positions     code.PositionTable
+	NumLocals     int
+	NumParameters int
+	LocalNames    []string // names of the local slots, for error messages
+	FreeNames     []string // names of the free variables, for error messages
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+// Closure is a compiled function together with the variables it captured.
+// It is a FUNCTION like the functions of the evaluator.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
 // String
 type String struct {
 	Value string
@@ -176,6 +344,41 @@ func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 
+// Range is the sequence of integers from Start up to, but not including,
+// End, counting by Step
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.End)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+func (r *Range) Type() ObjectType {
+	return RANGE_OBJ
+}
+
+// Module is an imported file. Its members are the top-level bindings of
+// the file.
+type Module struct {
+	Name string // file name of the module without its extension
+	Path string // absolute path of the file
+	Env  *Environment
+}
+
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("module %s", m.Name)
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+
 // Hash
 type HashKey struct {
 	Type  ObjectType
@@ -198,6 +401,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(b.Value.Bytes())
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -233,6 +445,57 @@ func (h *Hash) Type() ObjectType {
 	return HASH_OBJ
 }
 
+// Keys returns the keys of the hash in a stable order: booleans first,
+// then integers in numeric order, then strings in lexical order
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+
+	return keys
+}
+
+// lessKey orders two hash keys
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return keyTypeOrder(a) < keyTypeOrder(b)
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *BigInt:
+		return a.Value.Cmp(b.(*BigInt).Value) < 0
+	case *String:
+		return a.Value < b.(*String).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+// keyTypeOrder ranks the types of hash keys
+func keyTypeOrder(obj Object) int {
+	switch obj.Type() {
+	case BOOL_OBJ:
+		return 0
+	case INTEGER_OBJ:
+		return 1
+	case BIGINT_OBJ:
+		return 2
+	case STRING_OBJ:
+		return 3
+	default:
+		return 4
+	}
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -22,3 +22,24 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{1e-9, "1e-09"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for %g. expected=%q, got=%q",
+				tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
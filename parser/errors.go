@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/rielj/go-interpreter/token"
+)
+
+// DefaultErrorLimit is the number of errors after which the parser gives up
+const DefaultErrorLimit = 10
+
+// ParseError is a syntax error found while parsing
+type ParseError struct {
+	Pos      token.Position    // where the error was found
+	Expected []token.TokenType // the token types that would have been valid, if known
+	Found    token.Token       // the offending token
+	Msg      string            // a human readable description of the error
+}
+
+// Error returns the error message prefixed with its position
+func (e *ParseError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// addError records a parse error at the given token. While the parser is
+// recovering from an earlier error in the same statement, further errors
+// are dropped because they are almost always a consequence of the first one.
+func (p *Parser) addError(found token.Token, expected []token.TokenType, msg string) {
+	if p.recovering || p.tooManyErrors() {
+		return
+	}
+	p.recovering = true
+	p.errors = append(p.errors, &ParseError{
+		Pos:      found.Pos,
+		Expected: expected,
+		Found:    found,
+		Msg:      msg,
+	})
+}
+
+// tooManyErrors reports whether the error limit has been reached
+func (p *Parser) tooManyErrors() bool {
+	return p.errorLimit > 0 && len(p.errors) >= p.errorLimit
+}
+
+// synchronize skips tokens after a parse error until the end of the current
+// statement, so that parsing can resume at the next statement. The statement
+// began at the given brace depth, and braces opened inside it are skipped
+// as a whole.
+func (p *Parser) synchronize(depth int) {
+	p.recovering = false
+
+	for !p.curTokenIs(token.EOF) {
+		// Brace depth after the current token
+		level := p.braceDepth
+		switch p.curToken.Type {
+		case token.LBRACE:
+			level++
+		case token.RBRACE:
+			level--
+		}
+
+		if level < depth {
+			return
+		}
+		if level == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			// Stop in front of anything that starts a statement or closes
+			// the enclosing block
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.WHILE, token.FOR, token.IMPORT, token.EOF:
+				return
+			case token.RBRACE:
+				if depth > 0 {
+					return
+				}
+			}
+		}
+		p.nextToken()
+	}
+}
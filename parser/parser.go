@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/rielj/go-interpreter/ast"
 	"github.com/rielj/go-interpreter/lexer"
@@ -13,16 +16,30 @@ const (
 	_ int = iota
 	// LOWEST is the lowest precedence
 	LOWEST
+	// ASSIGN is the assignment precedence
+	ASSIGN // x = 5 or x += 5
+	// OR is the logical or precedence
+	OR // ||
+	// AND is the logical and precedence
+	AND // &&
+	// BITOR is the bitwise or precedence
+	BITOR // |
+	// BITXOR is the bitwise exclusive or precedence
+	BITXOR // ^
+	// BITAND is the bitwise and precedence
+	BITAND // &
 	// EQUALS is the equals precedence
 	EQUALS // ==
 	// LESSGREATER is the less/greater precedence
-	LESSGREATER // > or <
+	LESSGREATER // > or <, >= or <=
+	// SHIFT is the shift precedence
+	SHIFT // << or >>
 	// SUM is the sum precedence
 	SUM // +
 	// PRODUCT is the product precedence
 	PRODUCT // *
 	// PREFIX is the prefix precedence
-	PREFIX // -X or !X
+	PREFIX // -X, !X or ~X
 	// CALL is the call precedence
 	CALL // myFunction(X)
 	// INDEX is the index precedence
@@ -31,23 +48,44 @@ const (
 
 // precedences
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 // Parser is a type that represents a parser
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string
+	errors     []*ParseError
+	errorLimit int  // maximum number of errors to report, 0 for no limit
+	recovering bool // whether an error was reported in the current statement
+
+	loopDepth  int // number of loops enclosing the current statement
+	braceDepth int // number of braces opened and not closed before curToken
 
 	curToken  token.Token
 	peekToken token.Token
@@ -64,7 +102,7 @@ type (
 
 // New creates a new Parser
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*ParseError{}, errorLimit: DefaultErrorLimit}
 
 	// Register prefix parsing functions
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -80,10 +118,13 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
 
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 
@@ -95,13 +136,30 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	// Read two tokens to set curToken and peekToken
 	p.nextToken()
@@ -110,19 +168,34 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-// Errors returns the parser errors
+// Errors returns the parser error messages
 func (p *Parser) Errors() []string {
+	msgs := []string{}
+	for _, err := range p.errors {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// ParseErrors returns the parser errors
+func (p *Parser) ParseErrors() []*ParseError {
 	return p.errors
 }
 
+// SetErrorLimit sets the number of errors after which parsing stops.
+// A limit of 0 reports every error.
+func (p *Parser) SetErrorLimit(n int) {
+	p.errorLimit = n
+}
+
 // ParseProgram parses a program
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	// Loop through all the tokens until we reach the end of the file
-	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
+	for p.curToken.Type != token.EOF && !p.tooManyErrors() {
+		stmt := p.parseStatementOrSync()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -136,6 +209,14 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 // nextToken reads the next token from the lexer and sets curToken and peekToken
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		if p.braceDepth > 0 {
+			p.braceDepth--
+		}
+	}
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 }
@@ -263,6 +344,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.RBrace = p.curToken
 
 	return hash
 }
@@ -274,6 +356,10 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 
 	// Parse the elements
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.RBracket = p.curToken
 
 	return array
 }
@@ -320,6 +406,51 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString parses a string with embedded ${} expressions
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer untrace(trace("parseInterpolatedString"))
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		// Add the text before the next expression
+		if p.curToken.Literal != "" {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+
+		// Read the next token
+		p.nextToken()
+
+		// The braces must not be empty
+		if p.curTokenIs(token.STRING_MID) || p.curTokenIs(token.STRING_TAIL) {
+			p.addError(p.curToken, nil, "empty interpolation")
+			return nil
+		}
+
+		// Parse the embedded expression
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		// Check if the string continues with more text
+		switch {
+		case p.peekTokenIs(token.STRING_MID):
+			p.nextToken()
+		case p.peekTokenIs(token.STRING_TAIL):
+			p.nextToken()
+			if p.curToken.Literal != "" {
+				str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+			}
+			str.Tail = p.curToken
+			return str
+		case p.peekTokenIs(token.ILLEGAL):
+			p.addError(p.peekToken, nil, illegalMessage(p.peekToken))
+			return nil
+		default:
+			p.addError(p.peekToken, []token.TokenType{token.RBRACE},
+				fmt.Sprintf("expected } after interpolated expression, got %s instead", p.peekToken.Type))
+			return nil
+		}
+	}
+}
+
 // parseFunctionLiteral parses a function literal
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	defer untrace(trace("parseFunctionLiteral"))
@@ -338,9 +469,15 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// Loops outside the function cannot be left from inside its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+
 	// Parse the body
 	lit.Body = p.parseBlockStatement()
 
+	p.loopDepth = loopDepth
+
 	return lit
 }
 
@@ -391,9 +528,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	// Loop through all the statements until we reach a closing brace
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
 		// Parse the statement
-		stmt := p.parseStatement()
+		stmt := p.parseStatementOrSync()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
@@ -402,6 +539,11 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	// Remember the closing brace unless the input ended early
+	if p.curTokenIs(token.RBRACE) {
+		block.RBrace = p.curToken
+	}
+
 	return block
 }
 
@@ -410,14 +552,49 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	defer untrace(trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
+	// Describe malformed literals precisely
+	if msg := numberLiteralError(p.curToken.Literal); msg != "" {
+		p.addError(p.curToken, nil, msg)
+		return nil
+	}
+
 	// Try to parse the integer
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// Keep integers that are too large for an int64 as big integers
+		if bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = bigValue
+			return lit
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(
-			p.errors,
-			msg,
-		)
+		p.addError(p.curToken, nil, msg)
+		return nil
+	}
+
+	// Set the value
+	lit.Value = value
+
+	return lit
+}
+
+// parseFloatLiteral parses a float literal
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer untrace(trace("parseFloatLiteral"))
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	// Describe misplaced underscores precisely
+	if msg := numberLiteralError(p.curToken.Literal); msg != "" {
+		p.addError(p.curToken, nil, msg)
+		return nil
+	}
+
+	// Try to parse the float
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.addError(p.curToken, nil, msg)
 		return nil
 	}
 
@@ -427,6 +604,72 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// Helper function to describe what is wrong with a number literal, or
+// return "" if nothing is. Integers may have a 0x, 0o or 0b base prefix,
+// and an underscore may separate any two digits or follow a base prefix.
+// Decimal integers may not start with a zero, as that reads as octal in
+// other languages.
+func numberLiteralError(lit string) string {
+	base, name, digits := 10, "decimal", lit
+	if len(lit) >= 2 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			base, name = 16, "hexadecimal"
+		case 'o', 'O':
+			base, name = 8, "octal"
+		case 'b', 'B':
+			base, name = 2, "binary"
+		}
+	}
+	if base != 10 {
+		digits = lit[2:]
+		if strings.Trim(digits, "_") == "" {
+			return fmt.Sprintf("%s literal %s has no digits", name, lit)
+		}
+		for _, ch := range digits {
+			if ch != '_' && !isDigitOf(ch, base) {
+				return fmt.Sprintf("invalid digit %q in %s literal %s", ch, name, lit)
+			}
+		}
+	}
+
+	// Underscores need a digit (or the base prefix) before and a digit after
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' {
+			continue
+		}
+		before := i == 0 && base != 10 || i > 0 && isDigitOf(rune(digits[i-1]), base)
+		after := i+1 < len(digits) && isDigitOf(rune(digits[i+1]), base)
+		if !before || !after {
+			return fmt.Sprintf("'_' must separate successive digits in %s", lit)
+		}
+	}
+
+	// Reject leading zeros rather than guess which base was meant
+	if base == 10 && len(lit) > 1 && lit[0] == '0' && !strings.ContainsAny(lit, ".eE") {
+		msg := fmt.Sprintf("leading zeros are not allowed in %s", lit)
+		rest := strings.TrimLeft(lit, "0_")
+		if rest != "" && strings.Trim(rest, "01234567_") == "" {
+			msg += fmt.Sprintf(", use 0o%s for octal", rest)
+		}
+		return msg
+	}
+	return ""
+}
+
+// Helper function to check if a character is a digit in the base
+func isDigitOf(ch rune, base int) bool {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch-'0') < base
+	case 'a' <= ch && ch <= 'f':
+		return base == 16
+	case 'A' <= ch && ch <= 'F':
+		return base == 16
+	}
+	return false
+}
+
 // parseInfixExpression parses an infix expression
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	defer untrace(trace("parseInfixExpression"))
@@ -448,6 +691,40 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses an assignment expression
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	defer untrace(trace("parseAssignExpression"))
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	// A target that failed to parse has already been reported
+	if target == nil || p.recovering {
+		return nil
+	}
+
+	// Only names and index expressions can be assigned to. The target is
+	// named by its type, since printing a broken node is not safe.
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", strings.TrimPrefix(fmt.Sprintf("%T", target), "*ast."))
+		p.addError(p.curToken, nil, msg)
+		return nil
+	}
+
+	// Read the next token
+	p.nextToken()
+
+	// Parse the value with the lowest precedence so that assignments are
+	// right-associative
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
 // parseIndexExpression parses an index expression
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	defer untrace(trace("parseIndexExpression"))
@@ -463,6 +740,21 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	expression.RBracket = p.curToken
+
+	return expression
+}
+
+// parseMemberExpression parses a member access such as module.name
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	defer untrace(trace("parseMemberExpression"))
+	expression := &ast.MemberExpression{Token: p.curToken, Left: left}
+
+	// Check if the next token is the member name
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	return expression
 }
@@ -472,6 +764,10 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	defer untrace(trace("parseCallExpression"))
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+	exp.RParen = p.curToken
 	return exp
 }
 
@@ -514,6 +810,23 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// parseStatementOrSync parses a statement and skips to the end of it if
+// it could not be parsed
+func (p *Parser) parseStatementOrSync() ast.Statement {
+	errCount := len(p.errors)
+	depth := p.braceDepth
+
+	stmt := p.parseStatement()
+
+	// Discard the broken statement and resume at the next one
+	if len(p.errors) > errCount || p.recovering {
+		p.synchronize(depth)
+		return nil
+	}
+
+	return stmt
+}
+
 // parseStatement parses a statement
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
@@ -523,6 +836,21 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.RETURN:
 		// Parse a return statement
 		return p.parseReturnStatement()
+	case token.WHILE:
+		// Parse a while loop
+		return p.parseWhileStatement()
+	case token.FOR:
+		// Parse a for loop
+		return p.parseForStatement()
+	case token.BREAK:
+		// Parse a break statement
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		// Parse a continue statement
+		return p.parseContinueStatement()
+	case token.IMPORT:
+		// Parse an import statement
+		return p.parseImportStatement()
 	default:
 		// Parse an expression statement
 		return p.parseExpressionStatement()
@@ -550,10 +878,19 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // noPrefixParseFnError adds an error to the parser
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(
-		p.errors,
-		msg,
-	)
+	// Illegal tokens are better described by the lexer
+	if t == token.ILLEGAL {
+		msg = illegalMessage(p.curToken)
+	}
+	p.addError(p.curToken, nil, msg)
+}
+
+// illegalMessage describes why an ILLEGAL token is illegal
+func illegalMessage(tok token.Token) string {
+	if tok.Err != "" {
+		return tok.Err
+	}
+	return fmt.Sprintf("illegal character %q", tok.Literal)
 }
 
 // parseExpression parses an expression
@@ -635,6 +972,167 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseWhileStatement parses a while loop
+func (p *Parser) parseWhileStatement() ast.Statement {
+	defer untrace(trace("parseWhileStatement"))
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	// Check if the next token is an opening parenthesis
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// Read the next token
+	p.nextToken()
+
+	// Parse the condition
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	// Check if the next token is a closing parenthesis
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// Check if the next token is an opening brace
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// Parse the body
+	stmt.Body = p.parseLoopBody()
+
+	// Check if the next token is a semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForStatement parses a for loop
+func (p *Parser) parseForStatement() ast.Statement {
+	defer untrace(trace("parseForStatement"))
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	// Check if the next token is an opening parenthesis
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// Check if the next token is the loop variable
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	// Set the loop variable
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// Check if the next token is the in keyword
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	// Read the next token
+	p.nextToken()
+
+	// Parse the iterable
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	// Check if the next token is a closing parenthesis
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// Check if the next token is an opening brace
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// Parse the body
+	stmt.Body = p.parseLoopBody()
+
+	// Check if the next token is a semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block statement of a loop
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// parseImportStatement parses an import statement with an optional alias
+func (p *Parser) parseImportStatement() ast.Statement {
+	defer untrace(trace("parseImportStatement"))
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	// Check if the next token is the path of the module
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	// Check if the module is renamed
+	if p.peekTokenIs(token.AS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	// Check if the next token is a semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseBreakStatement parses a break statement
+func (p *Parser) parseBreakStatement() ast.Statement {
+	defer untrace(trace("parseBreakStatement"))
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	// Break is only valid inside a loop
+	if p.loopDepth == 0 {
+		p.addError(p.curToken, nil, "break outside of a loop")
+		return nil
+	}
+
+	// Check if the next token is a semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseContinueStatement parses a continue statement
+func (p *Parser) parseContinueStatement() ast.Statement {
+	defer untrace(trace("parseContinueStatement"))
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	// Continue is only valid inside a loop
+	if p.loopDepth == 0 {
+		p.addError(p.curToken, nil, "continue outside of a loop")
+		return nil
+	}
+
+	// Check if the next token is a semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // curTokenIs checks if the current token is of a certain type
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
@@ -652,10 +1150,11 @@ func (p *Parser) peekError(t token.TokenType) {
 		t,
 		p.peekToken.Type,
 	)
-	p.errors = append(
-		p.errors,
-		msg,
-	)
+	// The lexer knows better what is wrong with illegal input
+	if p.peekTokenIs(token.ILLEGAL) {
+		msg = illegalMessage(p.peekToken)
+	}
+	p.addError(p.peekToken, []token.TokenType{t}, msg)
 }
 
 // expectPeek checks if the next token is of a certain type
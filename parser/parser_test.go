@@ -6,6 +6,7 @@ import (
 
 	"github.com/rielj/go-interpreter/ast"
 	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -266,6 +267,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~15;", "~", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
 	}
@@ -373,6 +375,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -437,6 +449,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"1 + (2 + 3) + 4;",
 			"((1 + (2 + 3)) + 4)",
 		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || c",
+			"((a && b) || c)",
+		},
+		{
+			"a | b ^ c & d == e",
+			"(a | (b ^ (c & (d == e))))",
+		},
+		{
+			"a & b | c ^ d",
+			"((a & b) | (c ^ d))",
+		},
+		{
+			"1 << 2 + 3 < 4 >> 1",
+			"((1 << (2 + 3)) < (4 >> 1))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"x || y & z",
+			"(x || (y & z))",
+		},
+		{
+			"x = a <= b + 1 && c % 2 >= 1",
+			"x = ((a <= (b + 1)) && ((c % 2) >= 1))",
+		},
 		{
 			"(5 + 5) * 2;",
 			"((5 + 5) * 2)",
@@ -1435,3 +1479,615 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	)
 	t.Logf("Program: %s", program.String())
 }
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+		expectedEnd string
+	}{
+		{"foobar", "1:1", "1:7"},
+		{"1 + 2 * 3", "1:1", "1:10"},
+		{"-a", "1:1", "1:3"},
+		{"add(1,\n  2)", "1:1", "2:5"},
+		{"a[1]", "1:1", "1:5"},
+		{"[1, 2]", "1:1", "1:7"},
+		{`{"a": 1}`, "1:1", "1:9"},
+		{"if (x) {\n  y\n} else {\n  z\n}", "1:1", "5:2"},
+		{"fn(x) { x }", "1:1", "1:12"},
+		{"let x = 10;", "1:1", "1:11"},
+		{"  return x", "1:3", "1:11"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf(
+				"program has not enough statements. got=%d",
+				len(program.Statements),
+			)
+		}
+
+		stmt := program.Statements[0]
+		if stmt.Pos().String() != tt.expectedPos {
+			t.Errorf("%q: Pos() wrong. expected=%s, got=%s",
+				tt.input, tt.expectedPos, stmt.Pos())
+		}
+		if stmt.End().String() != tt.expectedEnd {
+			t.Errorf("%q: End() wrong. expected=%s, got=%s",
+				tt.input, tt.expectedEnd, stmt.End())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{"let = 5;", []string{
+			"1:5: expected next token to be IDENT, got = instead",
+		}},
+		{"let x = (1 + 2;", []string{
+			"1:15: expected next token to be ), got ; instead",
+		}},
+		// One typo yields one error, not a cascade
+		{"let x = (1 + ;", []string{
+			"1:14: no prefix parse function for ; found",
+		}},
+		// Parsing resumes at the next statement
+		{"let x 5;\nlet y = 10;\nlet = 1;", []string{
+			"1:7: expected next token to be =, got INT instead",
+			"3:5: expected next token to be IDENT, got = instead",
+		}},
+		{"if (x) { let 1; y }\nlet z = #;", []string{
+			"1:14: expected next token to be IDENT, got INT instead",
+			"2:9: illegal character \"#\"",
+		}},
+		// The lexer describes broken strings
+		{"let s = \"abc;\nlet t = 1;", []string{
+			"1:9: unterminated string",
+		}},
+		{`import "a\qb";`, []string{
+			`1:8: unknown escape sequence \q`,
+		}},
+		{"let x = 1; // fine\nlet y = /* oops", []string{
+			"2:9: unterminated comment",
+		}},
+		// Interpolated strings need an expression and a closing brace
+		{`"a ${} b"`, []string{
+			"1:6: empty interpolation",
+		}},
+		{`"a ${x y} b"`, []string{
+			"1:8: expected } after interpolated expression, got IDENT instead",
+		}},
+		{`"a ${x`, []string{
+			"1:7: expected } after interpolated expression, got EOF instead",
+		}},
+		// Malformed number literals
+		{"let mask = 0x;", []string{
+			"1:12: hexadecimal literal 0x has no digits",
+		}},
+		{"let mode = 0o789;", []string{
+			"1:12: invalid digit '8' in octal literal 0o789",
+		}},
+		{"0b12", []string{
+			"1:1: invalid digit '2' in binary literal 0b12",
+		}},
+		{"1__0 + 1_ + 2.5_", []string{
+			"1:1: '_' must separate successive digits in 1__0",
+		}},
+		{"let x = 1_;", []string{
+			"1:9: '_' must separate successive digits in 1_",
+		}},
+		{"let x = 1_.5;", []string{
+			"1:9: '_' must separate successive digits in 1_.5",
+		}},
+		// Recovery skips the blocks of a broken statement
+		{"if (x > ) { let a = 1; }", []string{
+			"1:9: no prefix parse function for ) found",
+		}},
+		{"while () {}", []string{
+			"1:8: no prefix parse function for ) found",
+		}},
+		{"for (x in ) {}", []string{
+			"1:11: no prefix parse function for ) found",
+		}},
+		{"{1 +: 2}", []string{
+			"1:5: no prefix parse function for : found",
+		}},
+		{"fn() { {1 +: 2}; let y = ; 1 }", []string{
+			"1:12: no prefix parse function for : found",
+			"1:26: no prefix parse function for ; found",
+		}},
+		{"let mode = 0755;", []string{
+			"1:12: leading zeros are not allowed in 0755, use 0o755 for octal",
+		}},
+		{"09 + 0_1", []string{
+			"1:1: leading zeros are not allowed in 09",
+		}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("%q: wrong number of errors. expected=%q, got=%q",
+				tt.input, tt.expectedErrors, errors)
+			continue
+		}
+
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("%q: wrong error. expected=%q, got=%q",
+					tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	l := lexer.New("add(1, 2;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(errors))
+	}
+
+	err := errors[0]
+	if err.Pos.Line != 1 || err.Pos.Column != 9 {
+		t.Errorf("err.Pos wrong. got=%s", err.Pos)
+	}
+	if len(err.Expected) != 1 || err.Expected[0] != token.RPAREN {
+		t.Errorf("err.Expected wrong. got=%v", err.Expected)
+	}
+	if err.Found.Type != token.SEMICOLON {
+		t.Errorf("err.Found wrong. got=%q", err.Found.Type)
+	}
+}
+
+func TestParseErrorLimit(t *testing.T) {
+	input := ""
+	for i := 0; i < 20; i++ {
+		input += "let = 1;\n"
+	}
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) != DefaultErrorLimit {
+		t.Errorf("expected %d errors, got=%d", DefaultErrorLimit, len(p.Errors()))
+	}
+
+	l = lexer.New(input)
+	p = New(l)
+	p.SetErrorLimit(3)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 3 {
+		t.Errorf("expected 3 errors, got=%d", len(p.Errors()))
+	}
+}
+
+func TestLoopTrailingSemicolon(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+	}{
+		{"let i = 0; while (i < 3) { i += 1 }; puts(i)", 3},
+		{"for (x in [1, 2]) { puts(x) }; 5", 2},
+		{"while (false) { };", 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: wrong number of statements. expected=%d, got=%d",
+				tt.input, tt.statements, len(program.Statements))
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x; break; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf(
+			"program has not enough statements. got=%d",
+			len(program.Statements),
+		)
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf(
+			"program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0],
+		)
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not ast.ContinueStatement. got=%T",
+			stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (item in items) { item }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf(
+			"program has not enough statements. got=%d",
+			len(program.Statements),
+		)
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf(
+			"program.Statements[0] is not ast.ForStatement. got=%T",
+			program.Statements[0],
+		)
+	}
+
+	if !testIdentifier(t, stmt.Variable, "item") {
+		return
+	}
+
+	if !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+
+	if stmt.String() != "for (item in items) item" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"if (x) { continue; }", "1:10: continue outside of a loop"},
+		{"while (x) { fn() { break; } }", "1:20: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q",
+				tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "x = 5"},
+		{"x += 1 * 2;", "x += (1 * 2)"},
+		{"x -= y", "x -= y"},
+		{"x *= y", "x *= y"},
+		{"x /= y", "x /= y"},
+		{"a = b = c", "a = b = c"},
+		{"arr[0] = 1", "(arr[0]) = 1"},
+		{`h["k"] += 2`, "(h[k]) += 2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf(
+				"program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0],
+			)
+		}
+
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 = 3", "1:7: cannot assign to InfixExpression"},
+		{"f(1) = 2", "1:6: cannot assign to CallExpression"},
+		// Broken targets report only their own error
+		{"(1 +) = 2", "1:5: no prefix parse function for ) found"},
+		{"f(1,) = 2", "1:5: no prefix parse function for ) found"},
+		{"a[) = 1", "1:3: no prefix parse function for ) found"},
+		{"-(1+) = 2", "1:5: no prefix parse function for ) found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{".5;", 0.5},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf(
+				"program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0],
+			)
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestBigIntegerLiteral(t *testing.T) {
+	l := lexer.New("123456789012345678901234567890")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Big == nil || literal.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("literal.Big wrong. got=%v", literal.Big)
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0x_dead_BEEF", 0xdeadbeef},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"0B_1_0", 2},
+		{"1_000_000", 1000000},
+		{"0", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Errorf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+			continue
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("%s: literal.Value wrong. expected=%d, got=%d",
+				tt.input, tt.expected, literal.Value)
+		}
+	}
+
+	// Large literals in any base become big integers
+	l := lexer.New("0x1_0000_0000_0000_0000")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal := stmt.Expression.(*ast.IntegerLiteral)
+	if literal.Big == nil || literal.Big.String() != "18446744073709551616" {
+		t.Errorf("literal.Big wrong. got=%v", literal.Big)
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedPath  string
+		expectedAlias string
+	}{
+		{`import "lib/math.mk";`, "lib/math.mk", ""},
+		{`import "strings" as s`, "strings", "s"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf(
+				"program has not enough statements. got=%d",
+				len(program.Statements),
+			)
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf(
+				"program.Statements[0] is not ast.ImportStatement. got=%T",
+				program.Statements[0],
+			)
+		}
+
+		if stmt.Path.Value != tt.expectedPath {
+			t.Errorf("stmt.Path.Value not %q. got=%q", tt.expectedPath, stmt.Path.Value)
+		}
+
+		if tt.expectedAlias == "" {
+			if stmt.Alias != nil {
+				t.Errorf("stmt.Alias not nil. got=%s", stmt.Alias)
+			}
+		} else if !testIdentifier(t, stmt.Alias, tt.expectedAlias) {
+			return
+		}
+	}
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"m.x", "m.x"},
+		{"m.f(1)", "m.f(1)"},
+		{"a.b.c", "a.b.c"},
+		{"-m.x", "(-m.x)"},
+		{"m.xs[0]", "(m.xs[0])"},
+		{"m.x + 1", "(m.x + 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"import lib;", "1:8: expected next token to be STRING, got IDENT instead"},
+		{`import "lib" as "l";`, "1:17: expected next token to be IDENT, got STRING instead"},
+		{"m.(x)", "1:3: expected next token to be IDENT, got ( instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestInterpolatedStringParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string
+		expectedParts int
+	}{
+		{`"total: ${count * 2} items"`, "total: ${(count * 2)} items", 3},
+		{`"${a}${b}"`, "${a}${b}", 2},
+		{`"${"${x}"}!"`, "${${x}}!", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+
+		if len(str.Parts) != tt.expectedParts {
+			t.Errorf("%q: wrong number of parts. expected=%d, got=%d", tt.input, tt.expectedParts, len(str.Parts))
+		}
+
+		if str.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, str.String())
+		}
+	}
+}
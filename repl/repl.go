@@ -2,49 +2,369 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/compiler"
 	"github.com/rielj/go-interpreter/evaluator"
 	"github.com/rielj/go-interpreter/lexer"
 	"github.com/rielj/go-interpreter/object"
 	"github.com/rielj/go-interpreter/parser"
+	"github.com/rielj/go-interpreter/token"
+	"github.com/rielj/go-interpreter/vm"
 )
 
 const PROMPT = ">> "
 
+// CONTINUATION_PROMPT is shown while a multi-line input is incomplete
+const CONTINUATION_PROMPT = ".. "
+
+const helpText = `Meta-commands:
+  :load FILE     run a script in the current environment
+  :env           list the bindings of the current environment
+  :reset         discard all bindings
+  :engine [NAME] show or switch the engine, "eval" or "vm"
+  :ast EXPR      print the parsed program
+  :tokens EXPR   print the tokens of the input
+  :history       print the input history
+  :help          print this message
+  :quit          leave the REPL
+`
+
+// HistoryFile is the file every input line is appended to, so that history
+// survives between sessions. An empty string disables persistent history.
+var HistoryFile = defaultHistoryFile()
+
+// defaultHistoryFile returns ~/.monkey_history, or "" if there is no home
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// Engine runs the input: "eval" is the tree-walking evaluator and "vm" the
+// bytecode compiler and virtual machine
+var Engine = "eval"
+
+// SearchPath lists the directories searched for imported modules that are
+// not found next to the importing file
+var SearchPath []string
+
+// session is the state of a running REPL
+type session struct {
+	out     io.Writer
+	engine  string
+	history []string
+
+	// State of the evaluator
+	env      *object.Environment
+	importer *evaluator.Importer
+
+	// State of the compiler and virtual machine
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	s := &session{out: out, engine: Engine}
+	s.reset()
+	s.loadHistory()
+
+	// Lines of the input that is being entered
+	var lines []string
 
 	for {
-		fmt.Printf(PROMPT)
+		if len(lines) == 0 {
+			io.WriteString(out, PROMPT)
+		} else {
+			io.WriteString(out, CONTINUATION_PROMPT)
+		}
+
 		scanned := scanner.Scan()
 		if !scanned {
+			// Run what was entered so far so that errors are reported
+			if len(lines) != 0 {
+				s.eval(lexer.New(strings.Join(lines, "\n")))
+			}
 			return
 		}
 
 		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		s.addHistory(line)
 
-		program := p.ParseProgram()
+		// Meta-commands are only recognised at the start of an input
+		if len(lines) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := s.metaCommand(strings.TrimSpace(line)); quit {
+				return
+			}
+			continue
+		}
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+
+		// Keep reading until the input is complete
+		if isIncomplete(input) {
 			continue
 		}
+		lines = nil
 
-		evaluated := evaluator.Eval(program, env)
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		s.eval(lexer.New(input))
+	}
+}
+
+// metaCommand runs a command such as ":load file" and reports whether the
+// REPL should stop
+func (s *session) metaCommand(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q":
+		return true
+	case ":help":
+		io.WriteString(s.out, helpText)
+	case ":load":
+		if arg == "" {
+			io.WriteString(s.out, "usage: :load FILE\n")
+			break
+		}
+		s.load(arg)
+	case ":env":
+		s.printEnv()
+	case ":reset":
+		s.reset()
+	case ":engine":
+		switch arg {
+		case "":
+			fmt.Fprintf(s.out, "%s\n", s.engine)
+		case "eval", "vm":
+			s.engine = arg
+		default:
+			fmt.Fprintf(s.out, "unknown engine %s, use eval or vm\n", arg)
+		}
+	case ":ast":
+		p := parser.New(lexer.New(arg))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(s.out, p.Errors())
+			break
+		}
+		io.WriteString(s.out, program.String()+"\n")
+	case ":tokens":
+		l := lexer.New(arg)
+		l.KeepComments()
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			fmt.Fprintf(s.out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		}
+	case ":history":
+		for i, line := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", i+1, line)
+		}
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type :help for a list of commands\n", name)
+	}
 
-		// If the evaluated object is not nil, print its string representation.
-		// Otherwise, print nothing.
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	return false
+}
+
+// eval parses and evaluates the input of the lexer and prints the result
+func (s *session) eval(l *lexer.Lexer) {
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+
+	var evaluated object.Object
+	if s.engine == "vm" {
+		evaluated = s.runVM(program)
+	} else {
+		ctx := evaluator.WithImporter(context.Background(), s.importer)
+		evaluated = evaluator.EvalContext(ctx, program, s.env, evaluator.Limits{})
+	}
+
+	// If the evaluated object is not nil, print its string representation.
+	// Otherwise, print nothing.
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+		// Show where runtime errors happened
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(s.out, err.StackTrace())
 		}
+	}
+}
 
+// runVM compiles and runs the program with the globals of earlier inputs.
+// It returns the value to print, which is nil after a let statement.
+func (s *session) runVM(program *ast.Program) object.Object {
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(s.out, "Woops! Compilation failed:\n %s\n", err)
+		return nil
 	}
+
+	bytecode := comp.Bytecode()
+	s.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, s.globals)
+	if err := machine.Run(); err != nil {
+		return err.(*object.Error)
+	}
+
+	// Only expression and return statements leave a value behind
+	if len(program.Statements) == 0 {
+		return nil
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return machine.LastPoppedStackElem()
+	default:
+		return nil
+	}
+}
+
+// load runs a script in the current environment
+func (s *session) load(filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintf(s.out, "could not load file: %s\n", err)
+		return
+	}
+	defer f.Close()
+
+	defer s.importer.Enter(filename)()
+	s.eval(lexer.NewFileReader(filename, f))
+}
+
+// reset discards the bindings of both engines
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.importer = evaluator.NewImporter(SearchPath...)
+
+	s.symbolTable = compiler.NewSymbolTable()
+	for i, def := range evaluator.Builtins {
+		s.symbolTable.DefineBuiltin(i, def.Name)
+	}
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+}
+
+// printEnv lists the bindings of the current engine
+func (s *session) printEnv() {
+	if s.engine != "vm" {
+		for _, name := range s.env.Names() {
+			val, _ := s.env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, val.Inspect())
+		}
+		return
+	}
+
+	bindings := map[string]object.Object{}
+	for i, name := range s.symbolTable.GlobalNames() {
+		if s.globals[i] != nil {
+			bindings[name] = s.globals[i]
+		}
+	}
+	names := []string{}
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%s = %s\n", name, bindings[name].Inspect())
+	}
+}
+
+// loadHistory reads the history of previous sessions
+func (s *session) loadHistory() {
+	if HistoryFile == "" {
+		return
+	}
+	data, err := os.ReadFile(HistoryFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+}
+
+// addHistory remembers an input line and appends it to the history file
+func (s *session) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	s.history = append(s.history, line)
+
+	if HistoryFile == "" {
+		return
+	}
+	f, err := os.OpenFile(HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, line+"\n")
+}
+
+// isIncomplete reports whether the input needs more lines to be a complete
+// program: it has unclosed parentheses, brackets or braces, or it ends with
+// an operator that expects a right-hand side
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	var last token.Token
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE, token.STRING_HEAD:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE, token.STRING_TAIL:
+			depth--
+		case token.ILLEGAL:
+			// Raw strings and block comments may span lines
+			if strings.HasPrefix(tok.Literal, "`") || strings.HasPrefix(tok.Literal, "/*") {
+				return true
+			}
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return true
+	}
+
+	switch last.Type {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK,
+		token.SLASH, token.PERCENT, token.EQ, token.NOT_EQ, token.LT, token.GT,
+		token.LT_EQ, token.GT_EQ, token.AND, token.OR, token.AMPERSAND,
+		token.PIPE, token.CARET, token.TILDE, token.SHIFT_LEFT,
+		token.SHIFT_RIGHT, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN,
+		token.SLASH_ASSIGN, token.COMMA, token.COLON:
+		return true
+	}
+
+	return false
 }
 
 func printParserErrors(out io.Writer, errors []string) {
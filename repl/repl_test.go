@@ -0,0 +1,146 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\n a + b\n};", false},
+		{"[1, 2,", true},
+		{"let x =", true},
+		{"1 +", true},
+		{"ready &&", true},
+		{"flags |", true},
+		{"foo(1)", false},
+		{"}", false},
+		{"let s = `first line", true},
+		{"let s = `first line\nsecond line`;", false},
+		{`let s = "unterminated`, false},
+		{`let s = "sum: ${ fn(a) {`, true},
+		{"let x = 1; /* a comment", true},
+		{"let x = 1; // a comment", false},
+		{"let s = \"sum: ${ fn(a) {\n a }(1) }\";", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t",
+				tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	setHistoryFile(t, filepath.Join(t.TempDir(), "history"))
+
+	script := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(script, []byte("let double = fn(x) { x * 2 };"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"let add = fn(a, b) {",
+		"  a + b",
+		"};",
+		"add(1,",
+		"  2)",
+		":load " + script,
+		"double(4)",
+		":env",
+		":reset",
+		":env",
+		":tokens let x",
+		":ast 1 + 2 * 3",
+		":quit",
+		"add(1, 1)",
+	}, "\n")
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := []string{
+		">> .. .. >> .. 3",
+		">> >> 8",
+		">> add = fn(a, b) {\n(a + b)\n}",
+		"double = fn(x) {\n(x * 2)\n}",
+		">> >> >> 1:1\tLET\t\"let\"",
+		"1:5\tIDENT\t\"x\"",
+		">> (1 + (2 * 3))",
+		">> ",
+	}
+	if out.String() != strings.Join(expected, "\n") {
+		t.Errorf("wrong output. expected=%q, got=%q", strings.Join(expected, "\n"), out.String())
+	}
+
+	history, err := os.ReadFile(HistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(history), "let add = fn(a, b) {\n  a + b\n};\n") {
+		t.Errorf("history not written. got=%q", history)
+	}
+}
+
+func TestStartWithVM(t *testing.T) {
+	setHistoryFile(t, "")
+	Engine = "vm"
+	defer func() { Engine = "eval" }()
+
+	empty := filepath.Join(t.TempDir(), "empty.mk")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"let a = 5;",
+		"let f = fn(x) { x + a };",
+		// Programs without statements leave no value
+		"// note",
+		":load " + empty,
+		"f(1)",
+		"f(true)",
+		":env",
+		":engine",
+		":engine eval",
+		"a",
+	}, "\n")
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := []string{
+		">> >> >> >> >> 6",
+		">> ERROR: type mismatch: BOOLEAN + INTEGER",
+		"    at 1:17",
+		"    in f called at 1:1",
+		">> a = 5",
+		"f = Closure[",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q. got=%q", want, got)
+		}
+	}
+	// The evaluator has bindings of its own
+	if !strings.HasSuffix(got, ">> vm\n>> >> ERROR: identifier not found: a\n    at 1:1\n>> ") {
+		t.Errorf("wrong output after switching engines. got=%q", got)
+	}
+}
+
+// Helper function to point the history at a file for the duration of a test
+func setHistoryFile(t *testing.T, path string) {
+	old := HistoryFile
+	HistoryFile = path
+	t.Cleanup(func() { HistoryFile = old })
+}
@@ -1,19 +1,57 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position immediately after the token
+	Err     string   // why the input is illegal, set for some ILLEGAL tokens
+}
+
+// Position is a location in the source code
+type Position struct {
+	Filename string // the file name, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (byte count)
+}
+
+// IsValid reports whether the position has been set
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position in the form file:line:column, line:column
+// when there is no file name, or "-" when the position is not valid
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
+	// COMMENT is a // or /* */ comment, only returned by lexers that keep
+	// comments
+	COMMENT = "COMMENT"
+
 	// Identifiers + literals
 	IDENT = "IDENT" // add, foobar, x, y, ...
 	INT   = "INT"   // 1343456
+	FLOAT = "FLOAT" // 3.14, 1e-9, .5
 
 	// Operators
 	ASSIGN   = "="
@@ -22,15 +60,38 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
 	EQ     = "=="
 	NOT_EQ = "!="
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+
+	// Logical operators, which only evaluate their right side if the left
+	// side does not decide the result
+	AND = "&&"
+	OR  = "||"
+
+	// Bitwise operators on integers
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
+	// Compound assignment
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	DOT       = "."
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -45,10 +106,23 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IMPORT   = "IMPORT"
+	AS       = "AS"
 
 	// String
 	STRING = "STRING"
 
+	// Parts of an interpolated string such as "a ${x} b ${y} c", which is
+	// lexed as STRING_HEAD, x, STRING_MID, y, STRING_TAIL
+	STRING_HEAD = "STRING_HEAD" // "a ${
+	STRING_MID  = "STRING_MID"  // } b ${
+	STRING_TAIL = "STRING_TAIL" // } c"
+
 	// Array
 	LBRACKET = "["
 	RBRACKET = "]"
@@ -58,13 +132,20 @@ const (
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"as":       AS,
 }
 
 // LookupIdent checks the keywords table to see whether the given identifier is
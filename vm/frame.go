@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/token"
+)
+
+// Frame is an active call of a closure
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// Stack depths at the start of the running loops, outermost first
+	loops []int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+// Instructions returns the bytecode the frame executes
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Pos returns the source position of the current instruction
+func (f *Frame) Pos() token.Position {
+	return f.cl.Fn.Positions.Lookup(f.ip)
+}
+
+// cell holds a variable that closures share with the scope defining it
+type cell struct {
+	value object.Object // nil until the variable is bound
+}
+
+func (c *cell) Inspect() string {
+	if c.value == nil {
+		return "cell"
+	}
+	return "cell(" + c.value.Inspect() + ")"
+}
+
+func (c *cell) Type() object.ObjectType {
+	return "CELL"
+}
+
+// iterator yields the elements of the iterable of a for loop
+type iterator struct {
+	next func() (object.Object, bool)
+}
+
+func (it *iterator) Inspect() string {
+	return "iterator"
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return "ITERATOR"
+}
@@ -0,0 +1,614 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/rielj/go-interpreter/code"
+	"github.com/rielj/go-interpreter/compiler"
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// Operators of the infix opcodes. The VM applies them with the evaluator's
+// semantics.
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+}
+
+// VM is a stack machine that runs compiled bytecode
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+}
+
+// New returns a VM that runs the bytecode with fresh globals
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore returns a VM that keeps its globals in s, so that they
+// survive between runs as the REPL needs
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainClosure := &object.Closure{Fn: bytecode.Main}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		// The main program keeps the variables of its loops on the stack
+		sp: bytecode.Main.NumLocals,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// LastPoppedStackElem returns the value of the last expression statement,
+// or of the return statement that ended the program
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program. Runtime errors are returned as *object.Error
+// with the position and stack trace of the failed instruction. Go panics
+// are turned into runtime errors as well.
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.runtimeError(newError("internal error: %v", r))
+		}
+	}()
+
+	if failed := vm.run(); failed != nil {
+		return vm.runtimeError(failed)
+	}
+	return nil
+}
+
+// Helper function to execute instructions until the program ends or fails
+func (vm *VM) run() *object.Error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			err = vm.push(evaluator.NULL)
+
+		case code.OpTrue:
+			err = vm.push(evaluator.TRUE)
+
+		case code.OpFalse:
+			err = vm.push(evaluator.FALSE)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual, code.OpBitAnd, code.OpBitOr,
+			code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			right := vm.pop()
+			left := vm.pop()
+
+			err = vm.pushResult(evaluator.EvalInfixOperator(infixOperators[op], left, right))
+
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.EvalPrefixOperator("-", vm.pop()))
+
+		case code.OpBang:
+			err = vm.pushResult(evaluator.EvalPrefixOperator("!", vm.pop()))
+
+		case code.OpBitNot:
+			err = vm.pushResult(evaluator.EvalPrefixOperator("~", vm.pop()))
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// The left side of && or || decides the result if it is falsy
+			// or truthy respectively
+			if evaluator.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		// Globals
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			val := vm.globals[globalIndex]
+			if val == nil {
+				err = newError("identifier not found: %s", nameOf(vm.globalNames, int(globalIndex)))
+				break
+			}
+			err = vm.push(val)
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if vm.globals[globalIndex] == nil {
+				err = newError("assignment to undeclared identifier: %s", nameOf(vm.globalNames, int(globalIndex)))
+				break
+			}
+			vm.globals[globalIndex] = vm.stack[vm.sp-1]
+
+		// Locals
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			val := vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if val == nil {
+				err = newError("identifier not found: %s", vm.localName(int(localIndex)))
+				break
+			}
+			err = vm.push(val)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpAssignLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			if vm.stack[slot] == nil {
+				err = newError("assignment to undeclared identifier: %s", vm.localName(int(localIndex)))
+				break
+			}
+			vm.stack[slot] = vm.stack[vm.sp-1]
+
+		// Cells of captured locals
+		case code.OpNewCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = &cell{}
+
+		case code.OpBoxLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			vm.stack[slot] = &cell{value: vm.stack[slot]}
+
+		case code.OpGetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c := vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*cell)
+			if c.value == nil {
+				err = newError("identifier not found: %s", vm.localName(int(localIndex)))
+				break
+			}
+			err = vm.push(c.value)
+
+		case code.OpSetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c := vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*cell)
+			c.value = vm.pop()
+
+		case code.OpAssignCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c := vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*cell)
+			if c.value == nil {
+				err = newError("assignment to undeclared identifier: %s", vm.localName(int(localIndex)))
+				break
+			}
+			c.value = vm.stack[vm.sp-1]
+
+		// Free variables
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			c := currentClosure.Free[freeIndex].(*cell)
+			if c.value == nil {
+				err = newError("identifier not found: %s", nameOf(currentClosure.Fn.FreeNames, int(freeIndex)))
+				break
+			}
+			err = vm.push(c.value)
+
+		case code.OpAssignFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			c := currentClosure.Free[freeIndex].(*cell)
+			if c.value == nil {
+				err = newError("assignment to undeclared identifier: %s", nameOf(currentClosure.Fn.FreeNames, int(freeIndex)))
+				break
+			}
+			c.value = vm.stack[vm.sp-1]
+
+		case code.OpLoadFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(evaluator.Builtins[builtinIndex].Builtin)
+
+		// Composite values
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash := vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.pushResult(hash)
+
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := evaluator.Interpolate(vm.stack[vm.sp-numParts : vm.sp])
+			vm.sp = vm.sp - numParts
+
+			err = vm.push(str)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err = vm.pushResult(evaluator.EvalIndex(left, index))
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err = vm.pushResult(evaluator.EvalIndexAssignment(left, index, val))
+
+		case code.OpDup2:
+			left := vm.stack[vm.sp-2]
+			right := vm.stack[vm.sp-1]
+
+			if err = vm.push(left); err == nil {
+				err = vm.push(right)
+			}
+
+		// Functions
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// A return statement of the main program ends it. The value
+			// stays right above the stack pointer as the last popped one.
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(evaluator.NULL)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		// Loops
+		case code.OpIter:
+			next, iterErr := evaluator.NewIterator(vm.pop())
+			if iterErr != nil {
+				err = iterErr
+				break
+			}
+			err = vm.push(&iterator{next: next})
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it := vm.stack[vm.sp-1].(*iterator)
+			elem, ok := it.next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			err = vm.push(elem)
+
+		case code.OpLoopEnter:
+			frame := vm.currentFrame()
+			frame.loops = append(frame.loops, vm.sp)
+
+		case code.OpLoopExit:
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-1]
+
+		case code.OpUnwind:
+			level := int(code.ReadUint8(ins[ip+1:]))
+			frame := vm.currentFrame()
+			frame.ip += 1
+
+			// Leave the loops nested in the one being continued or broken
+			vm.sp = frame.loops[level]
+			frame.loops = frame.loops[:level+1]
+
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helper function to call the closure or builtin below the arguments
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// Helper function to enter a closure. Its arguments become its first locals.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return newError("wrong number of arguments. got=%d, want=%d",
+			numArgs, cl.Fn.NumParameters)
+	}
+
+	basePointer := vm.sp - numArgs
+	if vm.framesIndex >= MaxFrames || basePointer+cl.Fn.NumLocals >= StackSize {
+		return &object.Error{Kind: object.STACK_OVERFLOW_ERROR, Message: "stack overflow"}
+	}
+
+	frame := NewFrame(cl, basePointer)
+	vm.pushFrame(frame)
+
+	// Locals start out unbound
+	for i := basePointer + numArgs; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// Helper function to call a builtin and replace it and its arguments with
+// the result
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		return vm.push(evaluator.NULL)
+	}
+	return vm.pushResult(result)
+}
+
+// Helper function to create a closure over the cells on top of the stack
+func (vm *VM) pushClosure(constIndex int, numFree int) *object.Error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return newError("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// Helper function to build an array from a range of the stack
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// Helper function to build a hash from key-value pairs on the stack
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}
+}
+
+// Helper function to push the result of an operation, failing on errors
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return &object.Error{Kind: object.STACK_OVERFLOW_ERROR, Message: "stack overflow"}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Helper function to add the position and the active calls to an error
+func (vm *VM) runtimeError(err *object.Error) *object.Error {
+	if !err.Pos.IsValid() {
+		err.Pos = vm.currentFrame().Pos()
+	}
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		err.Stack = append(err.Stack, object.Frame{
+			Function: vm.frames[i].cl.Fn.Name,
+			CallSite: vm.frames[i-1].Pos(),
+		})
+	}
+
+	return err
+}
+
+// Helper function to get the name of a local slot of the current function
+func (vm *VM) localName(index int) string {
+	return nameOf(vm.currentFrame().cl.Fn.LocalNames, index)
+}
+
+// Helper function to look up a name for an error message
+func nameOf(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,303 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rielj/go-interpreter/ast"
+	"github.com/rielj/go-interpreter/compiler"
+	"github.com/rielj/go-interpreter/evaluator"
+	"github.com/rielj/go-interpreter/lexer"
+	"github.com/rielj/go-interpreter/object"
+	"github.com/rielj/go-interpreter/parser"
+)
+
+// Every program has to produce the same value or error in both engines
+func TestSameResultsAsEvaluator(t *testing.T) {
+	tests := []string{
+		// Arithmetic and comparisons
+		"1 + 2 * 3 - 4 / 2",
+		"-5 + 10",
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 1 - 1",
+		"1.5 * 2 + 1",
+		"7 / 2.0",
+		"1 < 2 == true",
+		"2 > 1 != false",
+		"7 % 3 + -7 % 3",
+		"5.5 % 2",
+		"5 % 0",
+		"1 <= 2 == 3 >= 4",
+		`["a" < "b", "b" <= "a", "a" == "a", "a" != "b"]`,
+		"false && missing",
+		"true || missing",
+		"[1 && 2, false || 3, 0 || 4]",
+		"let f = fn(x) { x > 0 && x % 2 == 0 || x == -1 }; [f(4), f(3), f(-1)]",
+		"true && 1 + true",
+		"[0xf0 | 0x0f, 0xff & 0x0f, 5 ^ 3, ~0, ~(1 << 70)]",
+		"[1 << 63, -16 >> 2, (1 << 100) >> 99]",
+		"1 << -1",
+		"[0 << 2000000, 0 >> (1 << 64), 0 << -1]",
+		"~true",
+		"!5",
+		"!!null",
+		`"foo" + "bar"`,
+		"1 / 0",
+		"5 + true",
+		"-true",
+		`"a" - "b"`,
+		`let count = 3; "total: ${count * 2} items"`,
+		`"${[1, "a"]} and ${fn(x) { x }(true)}${"!"}"`,
+		`"${1 + true}"`,
+
+		// Conditionals
+		"if (1 > 2) { 10 }",
+		"if (1 < 2) { 10 } else { 20 }",
+		"if (false) { 10 } else { let x = 1; }",
+
+		// Bindings
+		"let a = 5; let b = a * 2; b",
+		"let a = 1; let a = a + 1; a",
+		"x",
+		"x = 5",
+		"let x = 1; x = x + 1; x *= 3",
+
+		// Composite values
+		"[1, 2 * 2, 3 + 3]",
+		"[1, 2, 3][1]",
+		"[1, 2, 3][3]",
+		"let h = {1: 2, true: 3}; [h[1], h[true]]",
+		`{"a": 1}["a"]`,
+		`{"a": 1}["b"]`,
+		"{}[[]]",
+		"1[0]",
+		"let a = [1, 2]; a[0] = 5; a[1] += 1; a",
+		"let a = [1]; a[1] = 2",
+		`let h = {}; h["k"] = 1; h["k"] -= 3; h`,
+
+		// Functions and closures
+		"let f = fn(a, b) { a + b }; f(1, 2)",
+		"fn() { }()",
+		"fn() { return 1; 2 }()",
+		"let f = fn(x) { x }; f()",
+		"5()",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+		"let adder = fn(a) { fn(b) { a + b } }; adder(2)(3)",
+		"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+		"let f = fn() { g() }; let g = fn() { 42 }; f()",
+		"fn() { let a = fn() { b() }; let b = fn() { 7 }; a() }()",
+		"let x = 10; let f = fn() { x = x + 1; x }; f(); f()",
+		"let f = fn() { let a = 1; let g = fn() { a }; let a = 2; g() }; f()",
+		"let f = fn() { let a = 1; fn() { fn() { a += 1 } } }; let g = f(); g()(); g()()",
+		// Names refer to what they shadow until their let has run
+		"let x = 1; let f = fn() { let x = x + 1; x }; f()",
+		"let x = 1; let s = 0; for (i in [1]) { let x = x + 1; s = x } s",
+		"fn() { puts(x); let x = 2 }()",
+		"let x = 1; fn() { let y = x; let x = 2; y }()",
+		"let x = 1; for (i in [1, 2]) { let y = x; let x = i * 10; x += y } x",
+		"let f = fn(a) { let g = fn() { let a = a * 2; let h = fn() { a }; h() }; [g(), a] }; f(3)",
+		"let f = fn() { let n = len([1]); let len = fn(x) { 0 }; n + len([]) }; f()",
+		"let n = len([1, 2]); let len = 5; n + len",
+
+		// Builtins
+		`len("four") + len([1, 2])`,
+		"first([7, 8]) + last([7, 8])",
+		"rest([1, 2, 3])",
+		"push([1], 2)",
+		"len(1)",
+		"int(2.9) + int(\"10\")",
+		"float(3)",
+		"range(1, 10, 3)",
+		`[len("héllo"), runeLen("héllo"), chars("größe")]`,
+
+		// Loops
+		"let i = 0; while (i < 5) { i += 1 } i",
+		"let s = 0; let i = 0; while (true) { i += 1; if (i > 10) { break } if (i == 4) { continue } s += i } s",
+		"let s = 0; for (x in [1, 2, 3]) { s += x } s",
+		"let s = 0; for (x in range(10)) { if (x == 5) { break } if (x == 1) { continue } s += x } s",
+		`let s = ""; for (c in "héllo") { s = c + s } s`,
+		`let s = []; for (k in {"b": 1, "a": 2}) { s = push(s, k) } s`,
+		"for (x in 5) { x }",
+		"let s = []; for (x in range(9223372036854775800, 9223372036854775807, 3)) { s = push(s, x) } s",
+		"let fs = []; for (i in range(3)) { fs = push(fs, fn() { i }) } [fs[0](), fs[1](), fs[2]()]",
+		"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 } [fs[0](), fs[2]()]",
+		"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } } 0 }; f()",
+		"let f = fn() { while (true) { break } }; f()",
+		"for (x in [1, 2]) { let y = x; } y",
+		// Loop control in the middle of an expression
+		"let n = 0; for (x in range(3000)) { let y = [1, if (true) { continue } else { 2 }]; n += 1 } n",
+		"let s = 0; for (x in [1, 2, 3, 4]) { s += if (x > 2) { break } else { x } } s",
+		"let s = 0; for (a in [1, 2, 3]) { for (b in [1, 2]) { s += [a, if (b == 2) { break } else { b }][1] } } s",
+		"let s = []; for (a in [1, 2, 3]) { let i = 0; while (if (a == 2) { continue } else { i < 2 }) { i += 1; s = push(s, a * 10 + i) } } s",
+		`let i = 0; while (i < 5) { i += 1; let h = {"k": if (i < 3) { continue } else { i }}; break } i`,
+		"let f = fn() { let y = if (true) { return 5 } else { 1 }; 10 }; f()",
+
+		// Top-level return
+		"return 3; 4",
+	}
+
+	for _, input := range tests {
+		program := parse(input)
+		expected := evaluator.Eval(program, object.NewEnvironment())
+		actual := runVM(t, program)
+
+		if expected == nil {
+			continue
+		}
+		if actual == nil {
+			t.Errorf("%q: no result from the vm, want=%s", input, expected.Inspect())
+			continue
+		}
+		if actual.Inspect() != expected.Inspect() {
+			t.Errorf("%q: wrong result. want=%s, got=%s",
+				input, expected.Inspect(), actual.Inspect())
+		}
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `let g = fn(x) {
+  x + true
+};
+let f = fn() { g(1) };
+f()`
+
+	err := runVM(t, parse(input))
+
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", err, err)
+	}
+
+	expected := "    at 2:3\n" +
+		"    in g called at 4:16\n" +
+		"    in f called at 5:1\n"
+	if errObj.StackTrace() != expected {
+		t.Errorf("wrong stack trace. expected=%q, got=%q", expected, errObj.StackTrace())
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	result := runVM(t, parse("let f = fn(n) { f(n + 1) }; f(0)"))
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+	if errObj.Message != "stack overflow" || errObj.Kind != object.STACK_OVERFLOW_ERROR {
+		t.Errorf("wrong error. got=%q (%s)", errObj.Message, errObj.Kind)
+	}
+}
+
+func TestGlobalsSurviveBetweenRuns(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range evaluator.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	constants := []object.Object{}
+
+	inputs := []string{
+		"let f = fn() { x }",
+		"let x = 5",
+		"f() * 2",
+	}
+
+	var result object.Object
+	for _, input := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		vm := NewWithGlobalsStore(bytecode, globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = vm.LastPoppedStackElem()
+	}
+
+	if result.Inspect() != "10" {
+		t.Errorf("wrong result. want=10, got=%s", result.Inspect())
+	}
+}
+
+// Bytecode read back from a file has to run like the bytecode it was
+// written from
+func TestDecodedBytecodeRuns(t *testing.T) {
+	input := `
+let big = 99999999999999999999;
+let counter = fn(start) {
+	let n = start;
+	fn() { n = n + 1.5; [len("count"), "count: ${n}", big] }
+};
+let next = counter(-3);
+next();
+next()
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if _, err := original.WriteTo(&buf); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	loaded, err := compiler.ReadBytecode(&buf)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+
+	want := runBytecode(t, original)
+	got := runBytecode(t, loaded)
+	if want.Inspect() != "[5, count: 0.0, 99999999999999999999]" {
+		t.Fatalf("wrong result from the original bytecode. got=%s", want.Inspect())
+	}
+	if got.Inspect() != want.Inspect() {
+		t.Errorf("wrong result from the decoded bytecode. want=%s, got=%s", want.Inspect(), got.Inspect())
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// runVM compiles and runs a program, returning its value or its error
+func runVM(t *testing.T, program *ast.Program) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return err.(*object.Error)
+	}
+
+	// Statements other than expressions and returns leave no value
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return vm.LastPoppedStackElem()
+	default:
+		return nil
+	}
+}
+
+// Helper function to run bytecode and return the last popped value
+func runBytecode(t *testing.T, bytecode *compiler.Bytecode) object.Object {
+	t.Helper()
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return vm.LastPoppedStackElem()
+}